@@ -0,0 +1,145 @@
+package gomux
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hunterdishner/errors"
+)
+
+// HealthCheck reports whether a dependency of the service is healthy.
+type HealthCheck func(ctx context.Context) error
+
+// AdminPort serves the operational endpoints (/health, /metrics and /routes) on a second listener so they are
+// never exposed on the API port. The listener binds to localhost unless AdminAddress says otherwise.
+func AdminPort(p int) Option {
+	return func(s *Server) {
+		s.adminPort = p
+	}
+}
+
+// AdminAddress sets the interface the admin listener binds to.
+func AdminAddress(host string) Option {
+	return func(s *Server) {
+		s.adminAddress = host
+	}
+}
+
+// Health registers a check run by the admin /health endpoint. Any failing check turns the response into a 503.
+func Health(name string, check HealthCheck) Option {
+	return func(s *Server) {
+		if s.healthChecks == nil {
+			s.healthChecks = map[string]HealthCheck{}
+		}
+		s.healthChecks[name] = check
+	}
+}
+
+// mountAdmin builds the admin router once every option has been applied.
+func (s *Server) mountAdmin() {
+	if s.adminPort == 0 {
+		return
+	}
+
+	s.admin = http.NewServeMux()
+	s.handleAdmin(Get("/health", s.health))
+	s.handleAdmin(Get("/metrics", s.metrics))
+	s.handleAdmin(Get("/routes", s.RouteTable))
+	s.handleAdmin(Get("/auth", s.routeAuth))
+	s.handleAdmin(Get("/workers", s.workerStats))
+	s.handleAdmin(Get("/schedules", s.scheduleStats))
+	s.handleAdmin(Get("/shedding", s.shedStats))
+	if s.latency != nil {
+		s.handleAdmin(Get("/timeouts", s.timeoutSuggestions))
+	}
+	if s.backpressure != nil {
+		s.handleAdmin(Get("/backpressure", s.backpressureStats))
+	}
+	if s.webhooks != nil {
+		s.handleAdmin(Get("/webhooks", s.webhookReport))
+	}
+	if s.flight != nil {
+		s.handleAdmin(NewRoute("", "/flightrecorder", s.flightRecorder))
+	}
+}
+
+// handleAdmin serves route on the admin listener.
+func (s *Server) handleAdmin(route Route) {
+	s.admin.Handle(route.Path, s.responseHandler(route))
+	s.unrouted = append(s.unrouted, RouteAuth{Method: route.Method, Path: route.Path, Admin: true})
+}
+
+func (s *Server) serveAdmin(ctx context.Context) error {
+	srv := &http.Server{
+		Addr:    net.JoinHostPort(s.adminAddress, strconv.Itoa(s.adminPort)),
+		Handler: s.admin,
+	}
+
+	ln, err := s.listenTCP(srv.Addr)
+	if err != nil {
+		return err
+	}
+
+	drained := s.drainOnDone(ctx, srv)
+
+	s.infof("\n%s admin started on %s\n", s.name, srv.Addr)
+	if err := srv.Serve(ln); err != http.ErrServerClosed {
+		return err
+	}
+
+	<-drained
+	return nil
+}
+
+type healthReport struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func (s *Server) health(w io.Writer, r *http.Request) (interface{}, error) {
+	report := healthReport{Status: "ok", Checks: map[string]string{}}
+	var failed []string
+	for name, check := range s.healthChecks {
+		if err := check(r.Context()); err != nil {
+			report.Checks[name] = err.Error()
+			failed = append(failed, name+": "+err.Error())
+			continue
+		}
+		report.Checks[name] = "ok"
+	}
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return nil, errors.E(errors.HTTP, errors.Code(http.StatusServiceUnavailable), "unhealthy: "+strings.Join(failed, "; "))
+	}
+
+	return report, nil
+}
+
+type runtimeMetrics struct {
+	Uptime     string `json:"uptime"`
+	Goroutines int    `json:"goroutines"`
+	HeapAlloc  uint64 `json:"heap_alloc"`
+	HeapInuse  uint64 `json:"heap_inuse"`
+	NumGC      uint32 `json:"num_gc"`
+}
+
+func (s *Server) metrics(w io.Writer, r *http.Request) (interface{}, error) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	return runtimeMetrics{
+		Uptime:     time.Since(s.started).Round(time.Second).String(),
+		Goroutines: runtime.NumGoroutine(),
+		HeapAlloc:  m.HeapAlloc,
+		HeapInuse:  m.HeapInuse,
+		NumGC:      m.NumGC,
+	}, nil
+}
@@ -0,0 +1,305 @@
+package gomux
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hunterdishner/errors"
+)
+
+// AuditEvent records a mutating request.
+type AuditEvent struct {
+	ID        string    `json:"id"`
+	Time      time.Time `json:"time"`
+	Principal string    `json:"principal,omitempty"`
+	Method    string    `json:"method"`
+	// Route is the path template of the route, e.g. "/api/users/{id}", and Path the requested path.
+	Route string `json:"route"`
+	Path  string `json:"path"`
+	// ResourceID is the value of the path variable naming the resource. See AuditOptions.ResourceVar.
+	ResourceID string            `json:"resource_id,omitempty"`
+	Vars       map[string]string `json:"vars,omitempty"`
+	// RequestHash is the hex SHA-256 of the request body the handler read.
+	RequestHash string `json:"request_hash"`
+	RemoteAddr  string `json:"remote_addr"`
+	Status      int    `json:"status"`
+	// Outcome is "success" below 400, "denied" for 401 and 403, "failure" for other 4xx and "error" for 5xx.
+	Outcome  string        `json:"outcome"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// AuditSink receives audit events, e.g. to write them to a log, a Kafka topic or a collector.
+type AuditSink interface {
+	Audit(ctx context.Context, event AuditEvent) error
+}
+
+// AuditSinkFunc adapts a function to an AuditSink.
+type AuditSinkFunc func(ctx context.Context, event AuditEvent) error
+
+func (f AuditSinkFunc) Audit(ctx context.Context, event AuditEvent) error {
+	return f(ctx, event)
+}
+
+// AuditOptions configures Audit. Zero values fall back to the defaults noted on each field.
+type AuditOptions struct {
+	// Sink receives the events. Defaults to LogAuditSink(nil).
+	Sink AuditSink
+	// Principal names who made the request. It sees the request as the route's middleware passes it on, so it
+	// can read what authentication put in the context. Defaults to the client certificate's common name, else
+	// the basic auth user.
+	Principal func(r *http.Request) string
+	// ResourceVar names the path variable holding the resource ID. Defaults to "id", else the last variable of
+	// the path.
+	ResourceVar string
+	// Timeout bounds each delivery to the sink. Defaults to 5 seconds.
+	Timeout time.Duration
+}
+
+// Audit records an AuditEvent for every POST, PUT, PATCH and DELETE request to the given routes, once the
+// handler is done. Requests the route's middleware rejects, e.g. as unauthenticated, are recorded too. Events
+// are delivered before the request completes, so a slow sink slows the routes; failed deliveries are logged.
+func Audit(opts AuditOptions, routes ...Route) []Route {
+	if opts.Sink == nil {
+		opts.Sink = LogAuditSink(nil)
+	}
+	if opts.Principal == nil {
+		opts.Principal = defaultPrincipal
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 5 * time.Second
+	}
+
+	for i := range routes {
+		switch routes[i].Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+			routes[i].audit = &opts
+		}
+	}
+
+	return routes
+}
+
+func defaultPrincipal(r *http.Request) string {
+	if id, ok := ClientIdentity(r.Context()); ok {
+		return id.CommonName
+	}
+	if user, _, ok := r.BasicAuth(); ok {
+		return user
+	}
+
+	return ""
+}
+
+type auditKey struct{}
+
+// auditRecord collects what the handler side of the route knows for its event.
+type auditRecord struct {
+	principal string
+	vars      map[string]string
+}
+
+// audited records the event of a request to the route described by tmpl. It wraps the route outside its
+// middleware; auditInner, inside it, sees the request as the handler does.
+func audited(opts *AuditOptions, tmpl string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &auditRecord{principal: opts.Principal(r), vars: mux.Vars(r)}
+		h := sha256.New()
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = &hashingBody{ReadCloser: r.Body, hash: h}
+		}
+		sw := &breakerWriter{ResponseWriter: w}
+
+		defer func() {
+			p := recover()
+			switch {
+			case p != nil:
+				sw.status = http.StatusInternalServerError
+			case sw.status == 0:
+				sw.status = http.StatusOK
+			}
+
+			event := AuditEvent{
+				ID:          newAuditID(),
+				Time:        start.UTC(),
+				Principal:   rec.principal,
+				Method:      r.Method,
+				Route:       tmpl,
+				Path:        r.URL.Path,
+				ResourceID:  resourceID(tmpl, rec.vars, opts.ResourceVar),
+				Vars:        rec.vars,
+				RequestHash: hex.EncodeToString(h.Sum(nil)),
+				RemoteAddr:  r.RemoteAddr,
+				Status:      sw.status,
+				Outcome:     auditOutcome(sw.status),
+				Duration:    time.Since(start),
+			}
+
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), opts.Timeout)
+			if err := opts.Sink.Audit(ctx, event); err != nil {
+				log.Printf("%+v", errors.E(errors.IO, errors.CodeServerError, fmt.Sprintf("audit %s %s: %v", event.Method, event.Path, err)))
+			}
+			cancel()
+
+			if p != nil {
+				panic(p)
+			}
+		}()
+
+		next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), auditKey{}, rec)))
+	})
+}
+
+// auditInner takes the principal and path variables from the request the route's middleware passed on.
+func auditInner(opts *AuditOptions, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rec, ok := r.Context().Value(auditKey{}).(*auditRecord); ok {
+			if principal := opts.Principal(r); principal != "" {
+				rec.principal = principal
+			}
+			rec.vars = mux.Vars(r)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+var pathVarPattern = regexp.MustCompile(`\{([^}:]+)(?::[^}]*)?\}`)
+
+// resourceID picks the value of the named variable, else of "id", else of the last variable of the path.
+func resourceID(tmpl string, vars map[string]string, name string) string {
+	if name != "" {
+		return vars[name]
+	}
+	if id, ok := vars["id"]; ok {
+		return id
+	}
+
+	if names := pathVarPattern.FindAllStringSubmatch(tmpl, -1); len(names) > 0 {
+		return vars[names[len(names)-1][1]]
+	}
+
+	return ""
+}
+
+func auditOutcome(status int) string {
+	switch {
+	case status >= 500:
+		return "error"
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return "denied"
+	case status >= 400:
+		return "failure"
+	}
+
+	return "success"
+}
+
+func newAuditID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// hashingBody hashes the request body as the handler reads it.
+type hashingBody struct {
+	io.ReadCloser
+	hash hash.Hash
+}
+
+func (b *hashingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.hash.Write(p[:n])
+	return n, err
+}
+
+// LogAuditSink writes each event as a line of JSON to l, or to the standard logger when l is nil.
+func LogAuditSink(l *log.Logger) AuditSink {
+	if l == nil {
+		l = log.Default()
+	}
+
+	return AuditSinkFunc(func(ctx context.Context, event AuditEvent) error {
+		b, err := json.Marshal(event)
+		if err != nil {
+			return errors.E(errors.Encoding, errors.CodeServerError, err)
+		}
+
+		l.Printf("audit: %s", b)
+		return nil
+	})
+}
+
+// KafkaProducer is the part of a Kafka client KafkaAuditSink needs, so any client library can be adapted.
+type KafkaProducer interface {
+	// Produce writes a message to topic.
+	Produce(ctx context.Context, topic string, key, value []byte) error
+}
+
+// KafkaAuditSink produces each event as JSON to topic, keyed by the resource ID so the events of a resource
+// stay in order.
+func KafkaAuditSink(p KafkaProducer, topic string) AuditSink {
+	return AuditSinkFunc(func(ctx context.Context, event AuditEvent) error {
+		b, err := json.Marshal(event)
+		if err != nil {
+			return errors.E(errors.Encoding, errors.CodeServerError, err)
+		}
+
+		key := event.ResourceID
+		if key == "" {
+			key = event.Route
+		}
+		if err := p.Produce(ctx, topic, []byte(key), b); err != nil {
+			return errors.E(errors.IO, errors.CodeServerError, err)
+		}
+		return nil
+	})
+}
+
+// HTTPAuditSink posts each event as JSON to url with client, or http.DefaultClient when client is nil.
+// Responses other than 2xx fail the delivery.
+func HTTPAuditSink(url string, client *http.Client) AuditSink {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return AuditSinkFunc(func(ctx context.Context, event AuditEvent) error {
+		b, err := json.Marshal(event)
+		if err != nil {
+			return errors.E(errors.Encoding, errors.CodeServerError, err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+		if err != nil {
+			return errors.E(errors.Invalid, errors.CodeServerError, err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return errors.E(errors.IO, errors.CodeServerError, err)
+		}
+		defer resp.Body.Close()
+		io.Copy(io.Discard, resp.Body)
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return errors.E(errors.HTTP, errors.CodeServerError, fmt.Sprintf("audit collector answered %s", resp.Status))
+		}
+		return nil
+	})
+}
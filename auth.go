@@ -0,0 +1,143 @@
+package gomux
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/hunterdishner/errors"
+)
+
+// Authenticate puts mw in front of each of the given routes, ahead of their own Middleware, and records them as
+// authenticated by scheme, e.g. "jwt" or "api-key", for the auth report.
+func Authenticate(scheme string, mw Middleware, routes ...Route) []Route {
+	for i := range routes {
+		routes[i].Auth = scheme
+		routes[i].Middleware = append([]Middleware{mw}, routes[i].Middleware...)
+	}
+
+	return routes
+}
+
+// Authentication authenticates every route passed to AddRoutes with mw under scheme, unless the route has
+// its own Auth or is marked Public.
+func Authentication(scheme string, mw Middleware) Option {
+	return func(s *Server) {
+		s.authScheme, s.authMiddleware = scheme, mw
+	}
+}
+
+// Public marks each of the given routes as intentionally unauthenticated, e.g. health checks and login, so the
+// auth report does not flag them.
+func Public(routes ...Route) []Route {
+	for i := range routes {
+		routes[i].Public = true
+	}
+
+	return routes
+}
+
+// AuthReportOptions configures ReportAuth.
+type AuthReportOptions struct {
+	// Allow lists route names or paths (as passed to AddRoutes) that may be unauthenticated, like Public. Admin
+	// endpoints are allowed by the path served on the admin listener, e.g. "/health".
+	Allow []string
+	// Fail makes Serve fail instead of starting while unauthenticated routes remain.
+	Fail bool
+}
+
+// ReportAuth logs the routes without authentication when Serve starts, i.e. those neither authenticated
+// through Authenticate or Authentication nor Public or allowed. Admin and profiling endpoints are reported too,
+// profiling as "basic" when it has credentials. The same report is served by the admin /auth endpoint.
+func ReportAuth(opts AuthReportOptions) Option {
+	return func(s *Server) {
+		s.authReport = &opts
+	}
+}
+
+// RouteAuth describes how a route is authenticated.
+type RouteAuth struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Name   string `json:"name,omitempty"`
+	// Auth is the scheme authenticating the route, empty when there is none.
+	Auth string `json:"auth,omitempty"`
+	// Public is true for routes marked Public or allowed by ReportAuth.
+	Public bool `json:"public"`
+	// Admin is true for the endpoints of the admin listener, whose Path is the one served there.
+	Admin bool `json:"admin,omitempty"`
+}
+
+// RouteAuth reports the authentication of every mounted route in the order the routes were added, followed by
+// the admin and profiling endpoints.
+func (s *Server) RouteAuth() []RouteAuth {
+	var allow []string
+	if s.authReport != nil {
+		allow = s.authReport.Allow
+	}
+
+	var report []RouteAuth
+	for _, route := range s.routes {
+		if !route.enabled {
+			continue
+		}
+
+		report = append(report, RouteAuth{
+			Method: route.Method,
+			Path:   "/" + s.name + route.Path,
+			Name:   route.Name,
+			Auth:   route.Auth,
+			Public: route.Public || contains(allow, route.Path) || route.Name != "" && contains(allow, route.Name),
+		})
+	}
+
+	for _, route := range s.unrouted {
+		route.Public = contains(allow, route.Path)
+		report = append(report, route)
+	}
+
+	return report
+}
+
+// Unauthenticated returns the mounted routes that are neither authenticated nor public.
+func (s *Server) Unauthenticated() []RouteAuth {
+	var unauthenticated []RouteAuth
+	for _, route := range s.RouteAuth() {
+		if route.Auth == "" && !route.Public {
+			unauthenticated = append(unauthenticated, route)
+		}
+	}
+
+	return unauthenticated
+}
+
+func (s *Server) routeAuth(w io.Writer, r *http.Request) (interface{}, error) {
+	return s.RouteAuth(), nil
+}
+
+// checkAuth logs the unauthenticated routes when ReportAuth is set, failing when it asks to.
+func (s *Server) checkAuth() error {
+	if s.authReport == nil {
+		return nil
+	}
+
+	unauthenticated := s.Unauthenticated()
+	if len(unauthenticated) == 0 {
+		return nil
+	}
+
+	routes := make([]string, 0, len(unauthenticated))
+	for _, route := range unauthenticated {
+		routes = append(routes, route.Method+" "+route.Path)
+	}
+
+	err := errors.E(errors.Invalid, errors.CodeServerError, fmt.Sprintf("%d unauthenticated routes: %s", len(routes), strings.Join(routes, ", ")))
+	if s.authReport.Fail {
+		return err
+	}
+
+	log.Printf("%+v", err)
+	return nil
+}
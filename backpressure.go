@@ -0,0 +1,183 @@
+package gomux
+
+import (
+	stderrors "errors"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BackpressureOptions configures TrackBackpressure.
+type BackpressureOptions struct {
+	// StallThreshold is how long a write or flush has to block to count as a stall. Defaults to 100ms.
+	StallThreshold time.Duration
+	// Disconnect drops a client once a single write or flush to it blocks this long, so slow readers of
+	// streamed responses cannot pile up buffered data. Zero keeps every client connected.
+	Disconnect time.Duration
+}
+
+// BackpressureStat is the write backpressure recorded for a route.
+type BackpressureStat struct {
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Responses uint64 `json:"responses"`
+	// SlowClients counts the responses that stalled at least once.
+	SlowClients  uint64 `json:"slow_clients"`
+	Stalls       uint64 `json:"stalls"`
+	StallTime    string `json:"stall_time"`
+	MaxStall     string `json:"max_stall"`
+	Disconnected uint64 `json:"disconnected"`
+}
+
+// TrackBackpressure times every write and flush of every route's responses, counting stalls and slow clients
+// per route, which matters most for streamed responses. Stats are served by the admin /backpressure endpoint
+// and BackpressureStats. Disconnect works through write deadlines, which also carry MinTransferRate, so only
+// one of the two should be used.
+func TrackBackpressure(opts BackpressureOptions) Option {
+	if opts.StallThreshold == 0 {
+		opts.StallThreshold = 100 * time.Millisecond
+	}
+
+	return func(s *Server) {
+		s.backpressure = &backpressureRecorder{opts: opts, routes: map[string]*backpressureRoute{}}
+	}
+}
+
+// BackpressureStats returns the stats of every route, sorted by path. It is empty unless TrackBackpressure
+// is set.
+func (s *Server) BackpressureStats() []BackpressureStat {
+	if s.backpressure == nil {
+		return nil
+	}
+
+	return s.backpressure.stats()
+}
+
+func (s *Server) backpressureStats(w io.Writer, r *http.Request) (interface{}, error) {
+	return s.BackpressureStats(), nil
+}
+
+type backpressureRecorder struct {
+	opts BackpressureOptions
+
+	mu     sync.RWMutex
+	routes map[string]*backpressureRoute
+}
+
+type backpressureRoute struct {
+	method, path string
+
+	responses, slowClients, stalls, disconnected uint64
+	stallTime, maxStall                          int64
+}
+
+// track wraps the handler of a route so the writes of every response it serves are timed.
+func (b *backpressureRecorder) track(method, path string, next http.Handler) http.Handler {
+	key := method + " " + path
+
+	b.mu.Lock()
+	route, ok := b.routes[key]
+	if !ok {
+		route = &backpressureRoute{method: method, path: path}
+		b.routes[key] = route
+	}
+	b.mu.Unlock()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bw := &backpressureWriter{ResponseWriter: w, rc: http.NewResponseController(w), opts: b.opts, route: route}
+		next.ServeHTTP(bw, r)
+
+		atomic.AddUint64(&route.responses, 1)
+		if bw.stalled {
+			atomic.AddUint64(&route.slowClients, 1)
+		}
+	})
+}
+
+type backpressureWriter struct {
+	http.ResponseWriter
+	rc    *http.ResponseController
+	opts  BackpressureOptions
+	route *backpressureRoute
+
+	stalled, dropped bool
+}
+
+func (w *backpressureWriter) Write(b []byte) (int, error) {
+	start := w.begin()
+	n, err := w.ResponseWriter.Write(b)
+	w.end(start, err)
+
+	return n, err
+}
+
+func (w *backpressureWriter) Flush() {
+	start := w.begin()
+	err := w.rc.Flush()
+	w.end(start, err)
+}
+
+// Unwrap lets http.ResponseController reach the connection's writer.
+func (w *backpressureWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *backpressureWriter) begin() time.Time {
+	now := time.Now()
+	if w.opts.Disconnect > 0 {
+		w.rc.SetWriteDeadline(now.Add(w.opts.Disconnect))
+	}
+
+	return now
+}
+
+func (w *backpressureWriter) end(start time.Time, err error) {
+	if d := time.Since(start); d >= w.opts.StallThreshold {
+		w.stalled = true
+		atomic.AddUint64(&w.route.stalls, 1)
+		atomic.AddInt64(&w.route.stallTime, int64(d))
+		for {
+			max := atomic.LoadInt64(&w.route.maxStall)
+			if int64(d) <= max || atomic.CompareAndSwapInt64(&w.route.maxStall, max, int64(d)) {
+				break
+			}
+		}
+	}
+
+	if err != nil && !w.dropped && stderrors.Is(err, os.ErrDeadlineExceeded) {
+		w.dropped = true
+		atomic.AddUint64(&w.route.disconnected, 1)
+	}
+}
+
+func (b *backpressureRecorder) stats() []BackpressureStat {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	stats := make([]BackpressureStat, 0, len(b.routes))
+	for _, r := range b.routes {
+		stats = append(stats, BackpressureStat{
+			Method:       r.method,
+			Path:         r.path,
+			Responses:    atomic.LoadUint64(&r.responses),
+			SlowClients:  atomic.LoadUint64(&r.slowClients),
+			Stalls:       atomic.LoadUint64(&r.stalls),
+			StallTime:    time.Duration(atomic.LoadInt64(&r.stallTime)).Round(time.Millisecond).String(),
+			MaxStall:     time.Duration(atomic.LoadInt64(&r.maxStall)).Round(time.Millisecond).String(),
+			Disconnected: atomic.LoadUint64(&r.disconnected),
+		})
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Path == stats[j].Path {
+			return stats[i].Method < stats[j].Method
+		}
+		return stats[i].Path < stats[j].Path
+	})
+
+	return stats
+}
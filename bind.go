@@ -0,0 +1,258 @@
+package gomux
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/hunterdishner/errors"
+)
+
+// Bind populates the struct pointed to by v from the request. Fields declare their source with an in tag:
+//
+//	type Input struct {
+//		ID     int      `in:"path=id"`
+//		Tenant string   `in:"header=X-Tenant,required"`
+//		Tags   []string `in:"query=tag"`
+//		Sort   string   `in:"query=sort,default=name,enum=name|created"`
+//		Body   User     `in:"body"`
+//	}
+//
+// Sources are path, query, header, form and body. A body field receives the decoded JSON body; when no field
+// is tagged body, a JSON body is decoded into v itself before the other sources are applied. Form fields are
+// read from url-encoded or multipart bodies; the files of a multipart body are removed once Bind returns, so
+// routes taking files use ReceiveUpload. Fields marked
+// required must be present in the request, default supplies the value of an absent one and enum lists the
+// values a field accepts, separated by |. Any failure is returned as a 400. The bound struct is then checked
+// with Validate.
+//
+// Values from the string based sources are parsed with the binder registered for the field's type (see
+// RegisterBinder), then encoding.TextUnmarshaler, then the builtin kinds.
+func Bind(r *http.Request, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return errors.E(errors.Invalid, errors.CodeServerError, fmt.Sprintf("gomux: Bind needs a pointer to a struct, got %T", v))
+	}
+	rv = rv.Elem()
+
+	fields, err := bindFields(rv.Type())
+	if err != nil {
+		return errors.E(errors.Invalid, errors.CodeServerError, err)
+	}
+
+	target, whole := rv, true
+	for _, f := range fields {
+		if f.source == "body" {
+			target, whole = rv.Field(f.index), false
+		}
+	}
+
+	if err := decodeBody(r, target.Addr().Interface()); err != nil {
+		return err
+	}
+
+	// Fields bound from another source must not be settable through the body.
+	if whole {
+		for _, f := range fields {
+			rv.Field(f.index).Set(reflect.Zero(rv.Field(f.index).Type()))
+		}
+	}
+
+	vars := mux.Vars(r)
+	query := r.URL.Query()
+	for _, f := range fields {
+		var raw []string
+		switch f.source {
+		case "body":
+			continue
+		case "path":
+			if val, ok := vars[f.key]; ok {
+				raw = []string{val}
+			}
+		case "query":
+			raw = query[f.key]
+		case "header":
+			raw = r.Header.Values(f.key)
+		case "form":
+			parsed := r.MultipartForm != nil
+			if err := r.ParseMultipartForm(32 << 20); err != nil && err != http.ErrNotMultipart {
+				if bodyErr := bodyError(err); bodyErr != nil {
+					return bodyErr
+				}
+				return errors.E(errors.Encoding, errors.CodeBadRequest, err)
+			}
+			// net/http only cleans up the form of the request it created, not of the copies routing makes.
+			if !parsed && r.MultipartForm != nil {
+				defer r.MultipartForm.RemoveAll()
+			}
+			raw = r.PostForm[f.key]
+		}
+
+		if len(raw) == 0 {
+			if f.required {
+				return errors.E(errors.Invalid, errors.CodeBadRequest, fmt.Sprintf("%s %q is required", f.source, f.key))
+			}
+			if !f.hasDefault {
+				continue
+			}
+			raw = []string{f.def}
+		}
+
+		if len(f.enum) > 0 {
+			for _, val := range raw {
+				if !contains(f.enum, val) {
+					return errors.E(errors.Invalid, errors.CodeBadRequest, fmt.Sprintf("%s %q: %q is not one of %s", f.source, f.key, val, strings.Join(f.enum, ", ")))
+				}
+			}
+		}
+
+		if err := setValue(rv.Field(f.index), raw); err != nil {
+			return errors.E(errors.Invalid, errors.CodeBadRequest, fmt.Sprintf("%s %q: %v", f.source, f.key, err))
+		}
+	}
+
+	return Validate(v)
+}
+
+type bindField struct {
+	index      int
+	source     string
+	key        string
+	required   bool
+	def        string
+	hasDefault bool
+	enum       []string
+}
+
+// bindFields parses the in tags of t.
+func bindFields(t reflect.Type) ([]bindField, error) {
+	var fields []bindField
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup("in")
+		if !ok || sf.PkgPath != "" {
+			continue
+		}
+
+		parts := strings.Split(tag, ",")
+		f := bindField{index: i}
+		f.source, f.key, _ = strings.Cut(parts[0], "=")
+		for _, flag := range parts[1:] {
+			name, value, _ := strings.Cut(flag, "=")
+			switch name {
+			case "required":
+				f.required = true
+			case "default":
+				f.def, f.hasDefault = value, true
+			case "enum":
+				f.enum = strings.Split(value, "|")
+			default:
+				return nil, fmt.Errorf("gomux: field %s has unknown in flag %q", sf.Name, flag)
+			}
+		}
+
+		switch f.source {
+		case "body":
+		case "path", "query", "header", "form":
+			if f.key == "" {
+				return nil, fmt.Errorf("gomux: field %s needs a name for its %s source", sf.Name, f.source)
+			}
+		default:
+			return nil, fmt.Errorf("gomux: field %s has unknown in source %q", sf.Name, f.source)
+		}
+
+		fields = append(fields, f)
+	}
+
+	return fields, nil
+}
+
+func decodeBody(r *http.Request, v interface{}) error {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+
+	if mediatype, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediatype == "application/x-www-form-urlencoded" || mediatype == "multipart/form-data" {
+		return nil
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && err != io.EOF {
+		if bodyErr := bodyError(err); bodyErr != nil {
+			return bodyErr
+		}
+		return errors.E(errors.Encoding, errors.CodeBadRequest, err)
+	}
+
+	return nil
+}
+
+// setValue parses raw into v. Slices take every value, other kinds the first.
+func setValue(v reflect.Value, raw []string) error {
+	if v.Kind() == reflect.Slice {
+		s := reflect.MakeSlice(v.Type(), len(raw), len(raw))
+		for i, r := range raw {
+			if err := setScalar(s.Index(i), r); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	}
+
+	return setScalar(v, raw[0])
+}
+
+func setScalar(v reflect.Value, raw string) error {
+	if ok, err := bindCustom(v, raw); ok {
+		return err
+	}
+
+	if v.Kind() == reflect.Ptr {
+		p := reflect.New(v.Type().Elem())
+		if err := setScalar(p.Elem(), raw); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", raw)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", raw)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not a non-negative integer", raw)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(raw, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not a number", raw)
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("cannot bind into %s", v.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package gomux
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// BinderFunc parses a raw path, query, header or form value into a value of the type it was registered for.
+type BinderFunc func(raw string) (interface{}, error)
+
+var binders = struct {
+	sync.RWMutex
+	m map[reflect.Type]BinderFunc
+}{m: map[reflect.Type]BinderFunc{}}
+
+// RegisterBinder registers fn as the parser Bind uses for fields of the same type as example, so domain types
+// such as money amounts or custom IDs parse the same way in every service, e.g.
+// gomux.RegisterBinder(Money{}, ParseMoney). Fields of type *T use the binder registered for T.
+func RegisterBinder(example interface{}, fn BinderFunc) {
+	binders.Lock()
+	defer binders.Unlock()
+	binders.m[reflect.TypeOf(example)] = fn
+}
+
+// bindCustom parses raw into v using a registered binder or encoding.TextUnmarshaler. It reports false when
+// neither applies to v's type.
+func bindCustom(v reflect.Value, raw string) (bool, error) {
+	binders.RLock()
+	fn, ok := binders.m[v.Type()]
+	binders.RUnlock()
+
+	if ok {
+		val, err := fn(raw)
+		if err != nil {
+			return true, err
+		}
+
+		rv := reflect.ValueOf(val)
+		if !rv.IsValid() || !rv.Type().AssignableTo(v.Type()) {
+			return true, fmt.Errorf("binder for %s returned %T", v.Type(), val)
+		}
+		v.Set(rv)
+		return true, nil
+	}
+
+	if v.Kind() != reflect.Ptr && v.CanAddr() {
+		if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return true, u.UnmarshalText([]byte(raw))
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,55 @@
+package gomux
+
+import (
+	stderrors "errors"
+	"fmt"
+	"net/http"
+
+	"github.com/hunterdishner/errors"
+)
+
+// MaxBodyBytes limits the size of request bodies on every route. Reading past the limit fails, and a handler
+// returning that failure (or Bind hitting it) responds with a 413.
+func MaxBodyBytes(n int64) Option {
+	return func(s *Server) {
+		s.maxBodyBytes = n
+	}
+}
+
+// bodyLimit resolves the body limit for a route, preferring its own setting over the server's.
+func (s *Server) bodyLimit(route Route) int64 {
+	if route.MaxBodyBytes != 0 {
+		return route.MaxBodyBytes
+	}
+
+	return s.maxBodyBytes
+}
+
+// limitBody rejects requests that declare a body larger than limit and caps reads of the rest.
+func limitBody(limit int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > limit {
+			w.Header().Set("Content-Type", "application/json")
+			writeError(w, r, defaultEncoder, &http.MaxBytesError{Limit: limit})
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// bodyError converts failures of the body limits into their responses: a 413 for an http.MaxBytesReader
+// overflow and a 408 for a body sent slower than MinTransferRate. It returns nil for any other error.
+func bodyError(err error) error {
+	if stderrors.Is(err, errSlowBody) {
+		return errors.E(errors.IO, errors.Code(http.StatusRequestTimeout), err.Error())
+	}
+
+	var maxErr *http.MaxBytesError
+	if !stderrors.As(err, &maxErr) {
+		return nil
+	}
+
+	return errors.E(errors.Invalid, errors.Code(http.StatusRequestEntityTooLarge), fmt.Sprintf("request body exceeds %d bytes", maxErr.Limit))
+}
@@ -0,0 +1,300 @@
+package gomux
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hunterdishner/errors"
+)
+
+// Bulkhead caps the requests the given routes serve at once at max, shared between them, so a slow dependency
+// behind them cannot take every connection and goroutine of the service. Requests beyond the cap are answered
+// with a 503 and a Retry-After of a second. A max that is not positive fails the routes in AddRoutes.
+func Bulkhead(max int, routes ...Route) []Route {
+	if max <= 0 {
+		for i := range routes {
+			routes[i].err = fmt.Errorf("bulkhead needs a positive max, got %d", max)
+		}
+		return routes
+	}
+
+	slots := make(chan struct{}, max)
+	for i := range routes {
+		routes[i].bulkhead = slots
+	}
+
+	return routes
+}
+
+// BreakerOptions configures a circuit breaker. Zero values fall back to the defaults noted on each field.
+type BreakerOptions struct {
+	// Name identifies the breaker in logs and errors, e.g. the dependency the routes call.
+	Name string
+	// FailureRate is the share of failed requests over the window that opens the breaker. Defaults to 0.5.
+	FailureRate float64
+	// MinRequests is how many requests the window needs before the failure rate counts. Defaults to 20.
+	MinRequests int
+	// Window is the rolling period the failure rate is measured over. Defaults to 10 seconds.
+	Window time.Duration
+	// OpenFor is how long the breaker rejects requests before letting probes through; it is also the
+	// Retry-After clients are sent. Defaults to 30 seconds.
+	OpenFor time.Duration
+	// Probes is how many requests are let through while half-open; all must succeed to close the breaker.
+	// Defaults to 1.
+	Probes int
+	// IsFailure says which response statuses count as failures. Defaults to 5xx. Handlers panicking always fail.
+	IsFailure func(status int) bool
+}
+
+// Breaker puts a circuit breaker, shared between them, in front of the given routes. When the failure rate of
+// the routes crosses opts.FailureRate, the breaker opens and requests are answered with a 503 and a Retry-After
+// without reaching the handlers. Once opts.OpenFor has passed, opts.Probes requests are let through: the breaker
+// closes when they succeed and opens again when one fails. Options out of range fail the routes in AddRoutes.
+func Breaker(opts BreakerOptions, routes ...Route) []Route {
+	b, err := newBreaker(opts)
+	for i := range routes {
+		if err != nil {
+			routes[i].err = err
+			continue
+		}
+		routes[i].breaker = b
+	}
+
+	return routes
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	}
+
+	return "closed"
+}
+
+// breakerBuckets is the number of slices the window is counted in.
+const breakerBuckets = 10
+
+type breakerBucket struct {
+	start           time.Time
+	total, failures int
+}
+
+type breaker struct {
+	opts BreakerOptions
+
+	mu        sync.Mutex
+	state     breakerState
+	openUntil time.Time
+	buckets   [breakerBuckets]breakerBucket
+	probing   int
+	probed    int
+}
+
+func newBreaker(opts BreakerOptions) (*breaker, error) {
+	if opts.FailureRate == 0 {
+		opts.FailureRate = 0.5
+	}
+	if opts.MinRequests == 0 {
+		opts.MinRequests = 20
+	}
+	if opts.Window == 0 {
+		opts.Window = 10 * time.Second
+	}
+	if opts.OpenFor == 0 {
+		opts.OpenFor = 30 * time.Second
+	}
+	if opts.Probes == 0 {
+		opts.Probes = 1
+	}
+	if opts.IsFailure == nil {
+		opts.IsFailure = func(status int) bool { return status >= 500 }
+	}
+
+	switch {
+	case opts.FailureRate < 0 || opts.FailureRate > 1:
+		return nil, fmt.Errorf("breaker %s: failure rate %g is not between 0 and 1", opts.Name, opts.FailureRate)
+	case opts.MinRequests < 0:
+		return nil, fmt.Errorf("breaker %s: min requests %d is negative", opts.Name, opts.MinRequests)
+	case opts.Window/breakerBuckets <= 0:
+		return nil, fmt.Errorf("breaker %s: window %s is too short", opts.Name, opts.Window)
+	case opts.OpenFor < 0:
+		return nil, fmt.Errorf("breaker %s: open for %s is negative", opts.Name, opts.OpenFor)
+	case opts.Probes < 0:
+		return nil, fmt.Errorf("breaker %s: probes %d is negative", opts.Name, opts.Probes)
+	}
+
+	return &breaker{opts: opts}, nil
+}
+
+// allow reports whether a request may pass and whether it is a probe, or how long the client should wait.
+func (b *breaker) allow(now time.Time) (ok, probe bool, retryAfter time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerOpen {
+		if now.Before(b.openUntil) {
+			return false, false, b.openUntil.Sub(now)
+		}
+		b.transition(breakerHalfOpen)
+		b.probing, b.probed = 0, 0
+	}
+
+	if b.state == breakerHalfOpen {
+		if b.probing+b.probed >= b.opts.Probes {
+			return false, false, time.Second
+		}
+		b.probing++
+		return true, true, 0
+	}
+
+	return true, false, 0
+}
+
+func (b *breaker) record(now time.Time, probe, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe {
+		b.probing--
+		switch {
+		case b.state != breakerHalfOpen:
+		case failed:
+			b.open(now)
+		default:
+			if b.probed++; b.probed >= b.opts.Probes {
+				b.buckets = [breakerBuckets]breakerBucket{}
+				b.transition(breakerClosed)
+			}
+		}
+		return
+	}
+	if b.state != breakerClosed {
+		return
+	}
+
+	width := b.opts.Window / breakerBuckets
+	start := now.Truncate(width)
+	bucket := &b.buckets[start.UnixNano()/int64(width)%breakerBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = breakerBucket{start: start}
+	}
+	bucket.total++
+	if failed {
+		bucket.failures++
+	}
+
+	var total, failures int
+	for _, bucket := range b.buckets {
+		if now.Sub(bucket.start) < b.opts.Window {
+			total += bucket.total
+			failures += bucket.failures
+		}
+	}
+	if total >= b.opts.MinRequests && float64(failures) >= b.opts.FailureRate*float64(total) {
+		b.open(now)
+	}
+}
+
+func (b *breaker) open(now time.Time) {
+	b.openUntil = now.Add(b.opts.OpenFor)
+	b.transition(breakerOpen)
+}
+
+func (b *breaker) transition(state breakerState) {
+	if b.state != state {
+		log.Printf("gomux: circuit breaker %s is %s", b.opts.Name, state)
+	}
+	b.state = state
+}
+
+// protect serves next through the breaker and the bulkhead of a route.
+func protect(route Route, next http.Handler) http.Handler {
+	b, slots := route.breaker, route.bulkhead
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slots != nil {
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			default:
+				unavailable(w, r, time.Second, fmt.Sprintf("%s %s is at its concurrency limit", route.Method, route.Path))
+				return
+			}
+		}
+
+		if b == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ok, probe, retryAfter := b.allow(time.Now())
+		if !ok {
+			unavailable(w, r, retryAfter, fmt.Sprintf("circuit breaker %s is open", b.opts.Name))
+			return
+		}
+
+		sw := &breakerWriter{ResponseWriter: w}
+		failed := true
+		defer func() {
+			b.record(time.Now(), probe, failed)
+		}()
+
+		next.ServeHTTP(sw, r)
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		failed = b.opts.IsFailure(sw.status)
+	})
+}
+
+func unavailable(w http.ResponseWriter, r *http.Request, retryAfter time.Duration, msg string) {
+	secs := int((retryAfter + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	w.Header().Set("Content-Type", "application/json")
+	writeError(w, r, defaultEncoder, errors.E(errors.HTTP, errors.Code(http.StatusServiceUnavailable), msg))
+}
+
+// breakerWriter keeps the status of a response for the breaker and audit events.
+type breakerWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *breakerWriter) WriteHeader(status int) {
+	if w.status == 0 && status >= 200 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *breakerWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *breakerWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *breakerWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,151 @@
+package gomux
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newTestBreaker(t *testing.T, opts BreakerOptions) *breaker {
+	t.Helper()
+
+	b, err := newBreaker(opts)
+	if err != nil {
+		t.Fatalf("newBreaker: %v", err)
+	}
+	return b
+}
+
+// serveBreaker runs a request through b at now, reporting whether it was let through.
+func serveBreaker(b *breaker, now time.Time, failed bool) bool {
+	ok, probe, _ := b.allow(now)
+	if ok {
+		b.record(now, probe, failed)
+	}
+	return ok
+}
+
+func TestBreakerStates(t *testing.T) {
+	b := newTestBreaker(t, BreakerOptions{Name: "test", FailureRate: 0.5, MinRequests: 4, Window: 10 * time.Second, OpenFor: 30 * time.Second, Probes: 2})
+	now := time.Unix(1700000000, 0)
+
+	// Closed: failures below MinRequests do not open it.
+	for i := 0; i < 3; i++ {
+		if !serveBreaker(b, now, true) {
+			t.Fatalf("request %d rejected while closed", i)
+		}
+	}
+	if b.state != breakerClosed {
+		t.Fatalf("state = %s after 3 requests, want closed", b.state)
+	}
+
+	// The fourth failure reaches MinRequests at a 100% failure rate.
+	serveBreaker(b, now, true)
+	if b.state != breakerOpen {
+		t.Fatalf("state = %s, want open", b.state)
+	}
+
+	// Open: requests are rejected with the time left as Retry-After.
+	ok, _, retryAfter := b.allow(now.Add(10 * time.Second))
+	if ok || retryAfter != 20*time.Second {
+		t.Fatalf("allow while open = %v, %s; want false, 20s", ok, retryAfter)
+	}
+
+	// Half-open after OpenFor: only Probes requests pass at once.
+	later := now.Add(31 * time.Second)
+	ok1, probe1, _ := b.allow(later)
+	ok2, probe2, _ := b.allow(later)
+	ok3, _, _ := b.allow(later)
+	if !ok1 || !probe1 || !ok2 || !probe2 || ok3 {
+		t.Fatalf("half-open allow = %v/%v, %v/%v, %v; want two probes then a rejection", ok1, probe1, ok2, probe2, ok3)
+	}
+	if b.state != breakerHalfOpen {
+		t.Fatalf("state = %s, want half-open", b.state)
+	}
+
+	// Both probes succeed: closed, with the old failures forgotten.
+	b.record(later, true, false)
+	if b.state != breakerHalfOpen {
+		t.Fatalf("state = %s after one probe, want half-open", b.state)
+	}
+	b.record(later, true, false)
+	if b.state != breakerClosed {
+		t.Fatalf("state = %s after the probes, want closed", b.state)
+	}
+	if !serveBreaker(b, later, true) || b.state != breakerClosed {
+		t.Fatalf("state = %s after one failure, want closed", b.state)
+	}
+}
+
+func TestBreakerFailedProbeReopens(t *testing.T) {
+	b := newTestBreaker(t, BreakerOptions{MinRequests: 1, OpenFor: time.Minute})
+	now := time.Unix(1700000000, 0)
+
+	serveBreaker(b, now, true)
+	if b.state != breakerOpen {
+		t.Fatalf("state = %s, want open", b.state)
+	}
+
+	later := now.Add(time.Minute)
+	if !serveBreaker(b, later, true) {
+		t.Fatal("probe rejected")
+	}
+	if b.state != breakerOpen || !b.openUntil.Equal(later.Add(time.Minute)) {
+		t.Fatalf("state = %s until %s, want open until %s", b.state, b.openUntil, later.Add(time.Minute))
+	}
+}
+
+func TestBreakerWindow(t *testing.T) {
+	b := newTestBreaker(t, BreakerOptions{FailureRate: 0.5, MinRequests: 4, Window: 10 * time.Second})
+	now := time.Unix(1700000000, 0)
+
+	serveBreaker(b, now, true)
+	serveBreaker(b, now, true)
+	// Failures older than the window no longer count.
+	later := now.Add(11 * time.Second)
+	serveBreaker(b, later, true)
+	serveBreaker(b, later, false)
+	serveBreaker(b, later, false)
+	if b.state != breakerClosed {
+		t.Fatalf("state = %s, want closed", b.state)
+	}
+	serveBreaker(b, later, true)
+	if b.state != breakerOpen {
+		t.Fatalf("state = %s at a 50%% failure rate, want open", b.state)
+	}
+}
+
+func TestBreakerOptionErrors(t *testing.T) {
+	for _, opts := range []BreakerOptions{
+		{FailureRate: 1.5},
+		{FailureRate: -0.1},
+		{MinRequests: -1},
+		{Window: time.Nanosecond},
+		{OpenFor: -time.Second},
+		{Probes: -1},
+	} {
+		if _, err := newBreaker(opts); err == nil {
+			t.Errorf("newBreaker(%+v) succeeded, want an error", opts)
+		}
+	}
+}
+
+func TestBulkheadRouteErrors(t *testing.T) {
+	handler := func(w io.Writer, r *http.Request) (interface{}, error) { return nil, nil }
+
+	for _, max := range []int{0, -1} {
+		s := New(context.Background(), "api")
+		s.AddRoutes(Bulkhead(max, Get("/x", handler))...)
+		if s.Err() == nil {
+			t.Errorf("Bulkhead(%d) mounted without an error", max)
+		}
+	}
+
+	s := New(context.Background(), "api")
+	s.AddRoutes(Breaker(BreakerOptions{FailureRate: 2}, Get("/x", handler))...)
+	if s.Err() == nil {
+		t.Error("Breaker with a failure rate of 2 mounted without an error")
+	}
+}
@@ -0,0 +1,278 @@
+package gomux
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hunterdishner/errors"
+)
+
+// CacheStore holds cached responses. Implementations must be safe for concurrent use.
+type CacheStore interface {
+	// Get returns the value stored under key, reporting false when there is none or it has expired.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// DeletePrefix removes every key starting with prefix.
+	DeletePrefix(ctx context.Context, prefix string) error
+}
+
+// CacheOptions configures response caching.
+type CacheOptions struct {
+	// Store defaults to the "cache" bucket of the EmbeddedStore.
+	Store CacheStore
+	// Vary lists request headers that take part in the cache key, e.g. Accept-Language or Authorization.
+	// Requests carrying Authorization or Cookie bypass the cache unless Vary names the header, so responses
+	// are never shared between users by accident.
+	Vary []string
+}
+
+// Cache caches the successful responses of GET routes that set CacheTTL. Entries are keyed by route, path,
+// query and the Vary headers, and can be dropped from mutation handlers with InvalidatePaths and
+// InvalidateRoute. Responses that set cookies or Cache-Control no-store/private are never cached, and
+// requests sending Cache-Control: no-cache skip the lookup. Only the headers the route itself sets are
+// stored, without CORS, hop-by-hop and Set-Cookie headers, so what outer middleware adds for one client is
+// never replayed to another.
+func Cache(opts CacheOptions) Option {
+	return func(s *Server) {
+		s.cache = &opts
+	}
+}
+
+// CacheFor sets the cache TTL of each of the given routes.
+func CacheFor(ttl time.Duration, routes ...Route) []Route {
+	for i := range routes {
+		routes[i].CacheTTL = ttl
+	}
+
+	return routes
+}
+
+// InvalidatePaths drops the cached responses of the GET routes serving the given request paths, e.g.
+// s.InvalidatePaths(r.Context(), "/api/users/42").
+func (s *Server) InvalidatePaths(ctx context.Context, paths ...string) error {
+	if s.cache == nil {
+		return nil
+	}
+
+	for _, path := range paths {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, path, nil)
+		if err != nil {
+			return errors.E(errors.Invalid, errors.CodeServerError, err)
+		}
+
+		var match mux.RouteMatch
+		if !s.mux.Match(req, &match) || match.Route == nil {
+			continue
+		}
+
+		tmpl, err := match.Route.GetPathTemplate()
+		if err != nil {
+			continue
+		}
+
+		if err := s.cache.Store.DeletePrefix(ctx, tmpl+"\x00"+req.URL.Path+"\x00"); err != nil {
+			return errors.E(errors.IO, errors.CodeServerError, err)
+		}
+	}
+
+	return nil
+}
+
+// InvalidateRoute drops every cached response of the named route.
+func (s *Server) InvalidateRoute(ctx context.Context, name string) error {
+	if s.cache == nil {
+		return nil
+	}
+
+	route := s.mux.Get(name)
+	if route == nil {
+		return errors.E(errors.Invalid, errors.CodeServerError, "no route named "+name)
+	}
+
+	tmpl, err := route.GetPathTemplate()
+	if err != nil {
+		return errors.E(errors.Invalid, errors.CodeServerError, err)
+	}
+
+	if err := s.cache.Store.DeletePrefix(ctx, tmpl+"\x00"); err != nil {
+		return errors.E(errors.IO, errors.CodeServerError, err)
+	}
+
+	return nil
+}
+
+type cachedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// cached serves a GET route from the cache, filling it on misses.
+func (s *Server) cached(route Route, next http.Handler) http.Handler {
+	tmpl := "/" + s.name + route.Path
+	if s.cache.Store == nil {
+		store, err := s.Store("cache")
+		if err != nil {
+			s.routeError(route, err)
+			return next
+		}
+		s.cache.Store = store
+	}
+	store, vary := s.cache.Store, s.cache.Vary
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if credentialed(r, vary) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := cacheKey(tmpl, r, vary)
+
+		if !strings.Contains(r.Header.Get("Cache-Control"), "no-cache") {
+			if b, ok, err := store.Get(r.Context(), key); err != nil {
+				log.Printf("%+v", errors.E(errors.IO, errors.CodeServerError, err))
+			} else if ok {
+				var resp cachedResponse
+				if err := json.Unmarshal(b, &resp); err == nil {
+					for k, v := range resp.Header {
+						w.Header()[k] = v
+					}
+					w.Header().Set("X-Cache", "HIT")
+					w.WriteHeader(resp.Status)
+					w.Write(resp.Body)
+					return
+				}
+			}
+		}
+
+		w.Header().Set("X-Cache", "MISS")
+		before := w.Header().Clone()
+		rec := &captureWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		if rec.status != http.StatusOK || !cacheable(w.Header()) {
+			return
+		}
+
+		header := handlerHeader(before, w.Header())
+		b, err := json.Marshal(cachedResponse{Status: rec.status, Header: header, Body: rec.body.Bytes()})
+		if err == nil {
+			err = store.Set(r.Context(), key, b, route.CacheTTL)
+		}
+		if err != nil {
+			log.Printf("%+v", errors.E(errors.IO, errors.CodeServerError, err))
+		}
+	})
+}
+
+// credentialed reports whether r carries credentials the cache key does not vary on.
+func credentialed(r *http.Request, vary []string) bool {
+	for _, h := range []string{"Authorization", "Cookie"} {
+		if r.Header.Get(h) == "" {
+			continue
+		}
+		varied := false
+		for _, v := range vary {
+			varied = varied || strings.EqualFold(v, h)
+		}
+		if !varied {
+			return true
+		}
+	}
+
+	return false
+}
+
+// handlerHeader returns the headers set between the before snapshot and after, keeping only the values
+// appended to headers that were already there, and dropping those that must not be replayed: CORS, hop-by-hop
+// and Set-Cookie headers.
+func handlerHeader(before, after http.Header) http.Header {
+	header := http.Header{}
+	for k, v := range after {
+		if skipReplayHeader(k) {
+			continue
+		}
+
+		prev := before[k]
+		if len(prev) <= len(v) && equalValues(prev, v[:len(prev)]) {
+			v = v[len(prev):]
+		}
+		if len(v) > 0 {
+			header[k] = append([]string(nil), v...)
+		}
+	}
+
+	return header
+}
+
+func skipReplayHeader(k string) bool {
+	switch k {
+	case "Set-Cookie", "Connection", "Keep-Alive", "Proxy-Connection", "Proxy-Authenticate", "Te", "Trailer",
+		"Transfer-Encoding", "Upgrade", "X-Cache":
+		return true
+	}
+
+	return strings.HasPrefix(k, "Access-Control-")
+}
+
+func equalValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func cacheable(h http.Header) bool {
+	if h.Get("Set-Cookie") != "" {
+		return false
+	}
+
+	cc := h.Get("Cache-Control")
+	return !strings.Contains(cc, "no-store") && !strings.Contains(cc, "private")
+}
+
+// cacheKey is the route template, path, sorted and escaped query and vary headers joined by NUL bytes, so the
+// route and path prefixes can be invalidated on their own.
+func cacheKey(tmpl string, r *http.Request, vary []string) string {
+	var b strings.Builder
+	b.WriteString(tmpl)
+	b.WriteByte(0)
+	b.WriteString(r.URL.Path)
+	b.WriteByte(0)
+	b.WriteString(r.URL.Query().Encode())
+
+	for _, h := range vary {
+		b.WriteByte(0)
+		b.WriteString(strings.Join(r.Header.Values(h), ","))
+	}
+
+	return b.String()
+}
+
+// captureWriter passes a response through while keeping a copy of its status and body.
+type captureWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *captureWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,136 @@
+package gomux
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryCache is an in-memory CacheStore that evicts the least recently used entry once it holds max entries.
+type MemoryCache struct {
+	max int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewMemoryCache creates a MemoryCache holding at most max entries.
+func NewMemoryCache(max int) *MemoryCache {
+	return &MemoryCache{max: max, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (c *MemoryCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	entry := el.Value.(*memoryEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(el)
+		return nil, false, nil
+	}
+
+	c.order.MoveToFront(el)
+	return entry.value, true, nil
+}
+
+func (c *MemoryCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+
+	c.entries[key] = c.order.PushFront(&memoryEntry{key: key, value: value, expires: time.Now().Add(ttl)})
+	for c.max > 0 && c.order.Len() > c.max {
+		c.remove(c.order.Back())
+	}
+
+	return nil
+}
+
+func (c *MemoryCache) DeletePrefix(ctx context.Context, prefix string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, el := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			c.remove(el)
+		}
+	}
+
+	return nil
+}
+
+func (c *MemoryCache) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*memoryEntry).key)
+}
+
+// RedisClient is the part of a Redis client RedisCache needs. Adapting a client library such as go-redis
+// takes a few lines, which keeps gomux free of the dependency.
+type RedisClient interface {
+	// Get returns the value of key, reporting false when it does not exist.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores value under key with an expiry (SET key value PX ttl).
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Scan returns every key matching a glob pattern (SCAN with MATCH).
+	Scan(ctx context.Context, pattern string) ([]string, error)
+	Del(ctx context.Context, keys ...string) error
+}
+
+// RedisCache is a CacheStore backed by Redis, so cached responses are shared between instances.
+type RedisCache struct {
+	client    RedisClient
+	namespace string
+}
+
+// NewRedisCache creates a RedisCache storing its keys under namespace, e.g. "gomux:users:".
+func NewRedisCache(client RedisClient, namespace string) *RedisCache {
+	return &RedisCache{client: client, namespace: namespace}
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	return c.client.Get(ctx, c.namespace+key)
+}
+
+func (c *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.client.Set(ctx, c.namespace+key, value, ttl)
+}
+
+func (c *RedisCache) DeletePrefix(ctx context.Context, prefix string) error {
+	keys, err := c.client.Scan(ctx, globEscape(c.namespace+prefix)+"*")
+	if err != nil || len(keys) == 0 {
+		return err
+	}
+
+	return c.client.Del(ctx, keys...)
+}
+
+// globEscape escapes the characters Redis treats specially in MATCH patterns.
+func globEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,111 @@
+package gomux
+
+import (
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// CapabilitiesOptions declares what the capabilities document reports beyond what the server derives from its
+// own configuration.
+type CapabilitiesOptions struct {
+	// Versions lists the API versions the service supports, e.g. "v1" and "v2".
+	Versions []string
+	// RateLimit describes the rate limit clients are held to, if any.
+	RateLimit *RateLimitPolicy
+}
+
+// RateLimitPolicy describes a rate limit for clients.
+type RateLimitPolicy struct {
+	Requests      int `json:"requests"`
+	WindowSeconds int `json:"window_seconds"`
+	// Scope says what the limit is counted per, e.g. "api-key" or "ip".
+	Scope string `json:"scope,omitempty"`
+}
+
+// ServiceCapabilities is the document answering OPTIONS on the service root.
+type ServiceCapabilities struct {
+	Service  string   `json:"service"`
+	Versions []string `json:"versions,omitempty"`
+	// MediaTypes lists the content types the routes respond with.
+	MediaTypes []string `json:"media_types"`
+	// AuthSchemes lists the schemes authenticating routes, see Authenticate.
+	AuthSchemes  []string         `json:"auth_schemes,omitempty"`
+	RateLimit    *RateLimitPolicy `json:"rate_limit,omitempty"`
+	Protocols    []string         `json:"protocols"`
+	MaxBodyBytes int64            `json:"max_body_bytes,omitempty"`
+}
+
+// Capabilities answers OPTIONS on the service root, /name/, with a ServiceCapabilities document so client SDKs
+// can configure themselves. The media types, auth schemes, protocols and body limit come from the server's
+// configuration and routes; versions and the rate limit from opts. The route is Public.
+func Capabilities(opts CapabilitiesOptions) Option {
+	return func(s *Server) {
+		s.capabilities = &opts
+	}
+}
+
+// mountCapabilities registers the capabilities route once every option has been applied.
+func (s *Server) mountCapabilities() {
+	if s.capabilities == nil {
+		return
+	}
+
+	s.AddRoutes(Public(NewRoute(http.MethodOptions, "/", s.serviceCapabilities))...)
+}
+
+func (s *Server) serviceCapabilities(w io.Writer, r *http.Request) (interface{}, error) {
+	caps := ServiceCapabilities{
+		Service:      s.name,
+		Versions:     s.capabilities.Versions,
+		RateLimit:    s.capabilities.RateLimit,
+		Protocols:    []string{"http/1.1"},
+		MaxBodyBytes: s.maxBodyBytes,
+	}
+
+	mediaTypes, schemes := map[string]bool{}, map[string]bool{}
+	for _, route := range s.routes {
+		if !route.enabled {
+			continue
+		}
+
+		if route.Handler != nil {
+			enc := route.Encoder
+			if enc == nil {
+				enc = defaultEncoder
+			}
+			mediaTypes[enc.ContentType()] = true
+		}
+		if route.Auth != "" {
+			schemes[route.Auth] = true
+		}
+	}
+	caps.MediaTypes, caps.AuthSchemes = sortedKeys(mediaTypes), sortedKeys(schemes)
+
+	if s.http2 && s.tls || s.h2c && !s.tls {
+		caps.Protocols = append(caps.Protocols, "h2")
+	}
+	if s.http3 {
+		caps.Protocols = append(caps.Protocols, "h3")
+	}
+	if s.grpc != nil {
+		caps.Protocols = append(caps.Protocols, "grpc")
+	}
+
+	if w, ok := w.(http.ResponseWriter); ok {
+		w.Header().Set("Allow", strings.Join(s.allowedMethods(r), ", "))
+	}
+
+	return caps, nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
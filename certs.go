@@ -0,0 +1,135 @@
+package gomux
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hunterdishner/errors"
+)
+
+const certPollInterval = 10 * time.Second
+
+// TLSFiles serves TLS with the certificate and key in the given files instead of server.crt and server.key,
+// reloading them without a restart whenever they change on disk or the process receives SIGHUP, so short
+// lived certificates rotate cleanly. A reload that fails is logged and the current certificate kept.
+func TLSFiles(certFile, keyFile string) Option {
+	return func(s *Server) {
+		s.certs = &certReloader{certFile: certFile, keyFile: keyFile, infof: s.infof}
+		s.tls = true
+	}
+}
+
+type certReloader struct {
+	certFile, keyFile string
+	infof             func(format string, args ...interface{})
+
+	once    sync.Once
+	started error
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	modified time.Time
+}
+
+// start loads the certificate and watches its files until ctx is done. It only does so the first time.
+func (c *certReloader) start(ctx context.Context) error {
+	c.once.Do(func() {
+		if c.started = c.load(); c.started != nil {
+			return
+		}
+		go c.watch(ctx)
+	})
+
+	return c.started
+}
+
+// configure returns a copy of conf serving the reloaded certificate.
+func (c *certReloader) configure(conf *tls.Config) *tls.Config {
+	cfg := &tls.Config{}
+	if conf != nil {
+		cfg = conf.Clone()
+	}
+	cfg.Certificates = nil
+	cfg.GetCertificate = c.get
+
+	return cfg
+}
+
+func (c *certReloader) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cert, nil
+}
+
+func (c *certReloader) load() error {
+	modified, err := c.modTime()
+	if err != nil {
+		return errors.E(errors.CodeServerError, errors.IO, err)
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return errors.E(errors.CodeServerError, errors.IO, err)
+	}
+
+	c.mu.Lock()
+	c.cert, c.modified = &cert, modified
+	c.mu.Unlock()
+
+	return nil
+}
+
+// modTime is the latest modification time of the two files.
+func (c *certReloader) modTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{c.certFile, c.keyFile} {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+func (c *certReloader) watch(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(certPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		case <-ticker.C:
+			modified, err := c.modTime()
+			c.mu.RLock()
+			unchanged := err == nil && modified.Equal(c.modified)
+			c.mu.RUnlock()
+			// A missing file is usually a rotation in progress; it is picked up on a later tick.
+			if err != nil || unchanged {
+				continue
+			}
+		}
+
+		if err := c.load(); err != nil {
+			log.Printf("%+v", err)
+			continue
+		}
+		c.infof("\nreloaded TLS certificate %s\n", c.certFile)
+	}
+}
@@ -0,0 +1,209 @@
+package gomux
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hunterdishner/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the deployment settings of a server, so they can come from the environment or a file rather
+// than being compiled in as options. Zero values keep the defaults of New.
+type Config struct {
+	Name      string `yaml:"name"`
+	Port      int    `yaml:"port"`
+	AdminPort int    `yaml:"admin_port"`
+	// CertFile and KeyFile enable TLS with the given files, see TLSFiles.
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// CORSOrigins replaces the default of allowing every origin.
+	CORSOrigins []string `yaml:"cors_origins"`
+
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	DrainTimeout      time.Duration `yaml:"drain_timeout"`
+
+	// LogLevel is "info" or "error", see LogLevel.
+	LogLevel string `yaml:"log_level"`
+}
+
+// Timeouts are the read and write timeouts of the server's connections, as on http.Server. Zero values leave
+// a timeout off.
+type Timeouts struct {
+	Read       time.Duration
+	ReadHeader time.Duration
+	Write      time.Duration
+	Idle       time.Duration
+}
+
+// ServerTimeouts sets the timeouts of the server's connections.
+func ServerTimeouts(t Timeouts) Option {
+	return func(s *Server) {
+		s.timeouts = t
+	}
+}
+
+// LogLevel sets what the server logs: "info", the default, logs startup and reload messages along with
+// errors, and "error" only errors.
+func LogLevel(level string) Option {
+	return func(s *Server) {
+		s.logLevel = level
+	}
+}
+
+// infof logs an informational message unless the log level is "error".
+func (s *Server) infof(format string, args ...interface{}) {
+	if s.logLevel != "error" {
+		log.Printf(format, args...)
+	}
+}
+
+// NewFromConfig creates a server from c, applying opts after the options c translates to.
+func NewFromConfig(ctx context.Context, c Config, opts ...Option) (*Server, error) {
+	var configured []Option
+	if c.Port != 0 {
+		configured = append(configured, Port(c.Port))
+	}
+	if c.AdminPort != 0 {
+		configured = append(configured, AdminPort(c.AdminPort))
+	}
+
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, errors.E(errors.Invalid, errors.CodeServerError, "gomux: config needs both cert_file and key_file")
+	}
+	if c.CertFile != "" {
+		configured = append(configured, TLSFiles(c.CertFile, c.KeyFile))
+	}
+
+	if len(c.CORSOrigins) > 0 {
+		configured = append(configured, AllowedOrigins(c.CORSOrigins...))
+	}
+
+	configured = append(configured, ServerTimeouts(Timeouts{
+		Read:       c.ReadTimeout,
+		ReadHeader: c.ReadHeaderTimeout,
+		Write:      c.WriteTimeout,
+		Idle:       c.IdleTimeout,
+	}))
+	if c.DrainTimeout != 0 {
+		configured = append(configured, DrainTimeout(c.DrainTimeout))
+	}
+
+	switch c.LogLevel {
+	case "", "info", "error":
+		configured = append(configured, LogLevel(c.LogLevel))
+	default:
+		return nil, errors.E(errors.Invalid, errors.CodeServerError, fmt.Sprintf("gomux: unknown log level %q", c.LogLevel))
+	}
+
+	return New(ctx, c.Name, append(configured, opts...)...), nil
+}
+
+// LoadConfig reads a Config from the YAML or JSON file at path, when path is not empty, then overrides it with
+// the environment variables named after the upper-cased yaml keys under prefix, e.g. USERS_PORT and
+// USERS_CORS_ORIGINS for the prefix "USERS_". An empty prefix leaves the environment alone. Lists are comma
+// separated and timeouts are durations like "30s".
+func LoadConfig(path, prefix string) (Config, error) {
+	var c Config
+
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return c, errors.E(errors.CodeServerError, errors.IO, err)
+		}
+		// JSON is valid YAML, so one decoder reads both.
+		if err := yaml.Unmarshal(b, &c); err != nil {
+			return c, errors.E(errors.Invalid, errors.CodeServerError, fmt.Sprintf("gomux: config %s: %v", path, err))
+		}
+	}
+
+	if prefix == "" {
+		return c, nil
+	}
+
+	env := configEnv{prefix: prefix}
+	env.string("NAME", &c.Name)
+	env.int("PORT", &c.Port)
+	env.int("ADMIN_PORT", &c.AdminPort)
+	env.string("CERT_FILE", &c.CertFile)
+	env.string("KEY_FILE", &c.KeyFile)
+	env.list("CORS_ORIGINS", &c.CORSOrigins)
+	env.duration("READ_TIMEOUT", &c.ReadTimeout)
+	env.duration("READ_HEADER_TIMEOUT", &c.ReadHeaderTimeout)
+	env.duration("WRITE_TIMEOUT", &c.WriteTimeout)
+	env.duration("IDLE_TIMEOUT", &c.IdleTimeout)
+	env.duration("DRAIN_TIMEOUT", &c.DrainTimeout)
+	env.string("LOG_LEVEL", &c.LogLevel)
+
+	if env.err != nil {
+		return c, errors.E(errors.Invalid, errors.CodeServerError, env.err)
+	}
+
+	return c, nil
+}
+
+// configEnv reads environment variables under a prefix, keeping the first parse failure.
+type configEnv struct {
+	prefix string
+	err    error
+}
+
+func (e *configEnv) lookup(key string) (string, bool) {
+	return os.LookupEnv(e.prefix + key)
+}
+
+func (e *configEnv) string(key string, v *string) {
+	if raw, ok := e.lookup(key); ok {
+		*v = raw
+	}
+}
+
+func (e *configEnv) list(key string, v *[]string) {
+	raw, ok := e.lookup(key)
+	if !ok {
+		return
+	}
+
+	*v = nil
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*v = append(*v, item)
+		}
+	}
+}
+
+func (e *configEnv) int(key string, v *int) {
+	raw, ok := e.lookup(key)
+	if !ok || e.err != nil {
+		return
+	}
+
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		e.err = fmt.Errorf("gomux: %s%s: %q is not an integer", e.prefix, key, raw)
+		return
+	}
+	*v = n
+}
+
+func (e *configEnv) duration(key string, v *time.Duration) {
+	raw, ok := e.lookup(key)
+	if !ok || e.err != nil {
+		return
+	}
+
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		e.err = fmt.Errorf("gomux: %s%s: %q is not a duration", e.prefix, key, raw)
+		return
+	}
+	*v = d
+}
@@ -0,0 +1,101 @@
+package gomux
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/cors"
+)
+
+// AllowPrivateNetwork answers Private Network Access preflights with Access-Control-Allow-Private-Network, so
+// pages on public origins may call the service on a private address. It applies to the default CORS handling
+// and is ignored when CustomCors is used.
+func AllowPrivateNetwork() Option {
+	return func(s *Server) {
+		s.corsOptions.AllowPrivateNetwork = true
+	}
+}
+
+// AllowedOrigins replaces the default of allowing every origin with the given ones, which may contain a
+// single * wildcard such as https://*.example.com. It is ignored when CustomCors is used.
+func AllowedOrigins(origins ...string) Option {
+	return func(s *Server) {
+		s.corsOptions.AllowedOrigins = origins
+	}
+}
+
+// NullOrigin sets whether requests with the opaque "null" origin, as sent by sandboxed iframes and file://
+// pages, pass the default CORS handling regardless of the allowed origins. Like AllowPrivateNetwork it is
+// ignored when CustomCors is used.
+func NullOrigin(allow bool) Option {
+	return func(s *Server) {
+		s.nullOrigin = &allow
+	}
+}
+
+// defaultCorsOptions applies the null origin policy to the server's CORS options.
+func (s *Server) defaultCorsOptions() cors.Options {
+	opts := s.corsOptions
+	if s.nullOrigin == nil {
+		return opts
+	}
+
+	if *s.nullOrigin {
+		if !contains(opts.AllowedOrigins, "*") {
+			opts.AllowedOrigins = append(append([]string(nil), opts.AllowedOrigins...), "null")
+		}
+		return opts
+	}
+
+	allowed := cors.New(opts)
+	opts.AllowOriginRequestFunc = func(r *http.Request, origin string) bool {
+		return origin != "null" && allowed.OriginAllowed(r)
+	}
+
+	return opts
+}
+
+// WithCors sets the CORS handling of each of the given routes, taking precedence over the server's own, e.g.
+// s.AddRoutes(gomux.WithCors(cors.AllowAll(), gomux.Post("/webhook", Webhook))...).
+func WithCors(c *cors.Cors, routes ...Route) []Route {
+	for i := range routes {
+		routes[i].Cors = c
+	}
+
+	return routes
+}
+
+// corsHandler applies the CORS handling of the route matching the request, falling back to base.
+func (s *Server) corsHandler(base *cors.Cors, next http.Handler) http.Handler {
+	global := base.Handler(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c := s.routeCorsFor(r); c != nil {
+			c.Handler(next).ServeHTTP(w, r)
+			return
+		}
+
+		global.ServeHTTP(w, r)
+	})
+}
+
+// routeCorsFor returns the CORS override of the route the request targets. Preflight requests are matched
+// using the method they ask about.
+func (s *Server) routeCorsFor(r *http.Request) *cors.Cors {
+	if len(s.routeCors) == 0 {
+		return nil
+	}
+
+	req := r
+	if method := r.Header.Get("Access-Control-Request-Method"); r.Method == http.MethodOptions && method != "" {
+		req = r.Clone(r.Context())
+		req.Method = method
+	}
+
+	var match mux.RouteMatch
+	if !s.mux.Match(req, &match) || match.Route == nil {
+		return nil
+	}
+
+	return s.routeCors[match.Route]
+}
@@ -0,0 +1,189 @@
+package gomux
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/hunterdishner/errors"
+)
+
+// CSRFOptions configures CSRF protection. Zero values fall back to the defaults noted on each field.
+type CSRFOptions struct {
+	// CookieName defaults to "csrf_token".
+	CookieName string
+	// HeaderName defaults to "X-CSRF-Token".
+	HeaderName string
+	// FormField is checked when the header is absent, in application/x-www-form-urlencoded bodies of at most
+	// 64KB. Other bodies, e.g. multipart forms, must send the header. Defaults to "csrf_token".
+	FormField string
+	// SameSite defaults to http.SameSiteLaxMode.
+	SameSite http.SameSite
+	// Path defaults to "/".
+	Path string
+	// Insecure drops the Secure attribute from the cookie, for local development over plain HTTP.
+	Insecure bool
+	// Exempt lists route names or paths (as passed to AddRoutes) that skip the check, e.g. webhooks
+	// authenticated by other means.
+	Exempt []string
+}
+
+// csrfMaxForm is the largest urlencoded body searched for the form field.
+const csrfMaxForm = 64 << 10
+
+type csrfKey struct{}
+
+// CSRF protects unsafe requests with a double-submit cookie: every response carries a random token in a
+// cookie, and POST, PUT, PATCH and DELETE requests must echo it in a header or form field. Failures are
+// answered with a 403.
+func CSRF(opts CSRFOptions) Option {
+	if opts.CookieName == "" {
+		opts.CookieName = "csrf_token"
+	}
+	if opts.HeaderName == "" {
+		opts.HeaderName = "X-CSRF-Token"
+	}
+	if opts.FormField == "" {
+		opts.FormField = "csrf_token"
+	}
+	if opts.SameSite == 0 {
+		opts.SameSite = http.SameSiteLaxMode
+	}
+	if opts.Path == "" {
+		opts.Path = "/"
+	}
+
+	return func(s *Server) {
+		s.middleware = append(s.middleware, s.csrf(opts))
+	}
+}
+
+// CSRFToken returns the token of the request, for rendering into forms. It is empty when CSRF is not enabled.
+func CSRFToken(r *http.Request) string {
+	token, _ := r.Context().Value(csrfKey{}).(string)
+	return token
+}
+
+func (s *Server) csrf(opts CSRFOptions) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var token string
+			if c, err := r.Cookie(opts.CookieName); err == nil && c.Value != "" {
+				token = c.Value
+			}
+
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			default:
+				if !s.csrfExempt(r, opts.Exempt) && !validCSRF(r, opts, token) {
+					w.Header().Set("Content-Type", "application/json")
+					writeError(w, r, defaultEncoder, errors.E(errors.Invalid, errors.Code(http.StatusForbidden), "missing or invalid CSRF token"))
+					return
+				}
+			}
+
+			if token == "" {
+				var err error
+				if token, err = newCSRFToken(); err != nil {
+					w.Header().Set("Content-Type", "application/json")
+					writeError(w, r, defaultEncoder, errors.E(errors.IO, errors.CodeServerError, err))
+					return
+				}
+
+				http.SetCookie(w, &http.Cookie{
+					Name:     opts.CookieName,
+					Value:    token,
+					Path:     opts.Path,
+					Secure:   !opts.Insecure,
+					SameSite: opts.SameSite,
+				})
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), csrfKey{}, token)))
+		})
+	}
+}
+
+func validCSRF(r *http.Request, opts CSRFOptions, token string) bool {
+	if token == "" {
+		return false
+	}
+
+	sent := r.Header.Get(opts.HeaderName)
+	if sent == "" {
+		sent = csrfFormValue(r, opts.FormField)
+	}
+
+	return sent != "" && subtle.ConstantTimeCompare([]byte(sent), []byte(token)) == 1
+}
+
+// csrfFormValue returns field from a urlencoded body, leaving the body for the handler to read in full. It is
+// empty for other bodies and those over csrfMaxForm, which the middleware does not parse.
+func csrfFormValue(r *http.Request, field string) string {
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if ct != "application/x-www-form-urlencoded" || r.Body == nil || r.Body == http.NoBody {
+		return ""
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, csrfMaxForm+1))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil || len(body) > csrfMaxForm {
+		return ""
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return ""
+	}
+
+	return form.Get(field)
+}
+
+// csrfExempt reports whether the route the request targets is listed by name or path in exempt.
+func (s *Server) csrfExempt(r *http.Request, exempt []string) bool {
+	if len(exempt) == 0 {
+		return false
+	}
+
+	var match mux.RouteMatch
+	if !s.mux.Match(r, &match) || match.Route == nil {
+		return false
+	}
+
+	if name := match.Route.GetName(); name != "" && contains(exempt, name) {
+		return true
+	}
+
+	tmpl, err := match.Route.GetPathTemplate()
+	if err != nil {
+		return false
+	}
+
+	for _, e := range exempt {
+		if "/"+s.name+"/"+strings.TrimPrefix(e, "/") == tmpl {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
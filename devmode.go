@@ -0,0 +1,66 @@
+package gomux
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+
+	"github.com/hunterdishner/errors"
+)
+
+// ResponseCheck selects what happens when a handler returns something other than its route's declared
+// Response type.
+type ResponseCheck int
+
+const (
+	// ResponseCheckOff skips the check. This is the default.
+	ResponseCheckOff ResponseCheck = iota
+	// ResponseCheckLog logs mismatches and sends the response anyway.
+	ResponseCheckLog
+	// ResponseCheckFail logs mismatches and answers with a 500 instead.
+	ResponseCheckFail
+)
+
+// CheckResponses compares what each handler returns against its route's declared Response type, to catch
+// drift between handlers and their documented responses during development. Pointers are ignored on both
+// sides and nil results always pass.
+func CheckResponses(mode ResponseCheck) Option {
+	return func(s *Server) {
+		s.responseCheck = mode
+	}
+}
+
+// checkResponse returns an error when data does not match the route's declared response and the server is
+// set to fail on mismatches.
+func (s *Server) checkResponse(route Route, data interface{}) error {
+	if s.responseCheck == ResponseCheckOff || route.Response == nil || data == nil {
+		return nil
+	}
+
+	want, got := indirectType(reflect.TypeOf(route.Response)), indirectType(reflect.TypeOf(data))
+	if want == got {
+		return nil
+	}
+
+	msg := fmt.Sprintf("%s %s returned %s, declared %s", route.Method, route.Path, got, want)
+	log.Printf("%+v", errors.E(errors.Invalid, errors.CodeServerError, msg))
+	if s.responseCheck == ResponseCheckFail {
+		return errors.E(errors.Invalid, errors.Code(http.StatusInternalServerError), msg)
+	}
+
+	return nil
+}
+
+// indirectType strips the pointers from t and from the elements of slices, so User, *User, []User and []*User
+// compare as the response User{} or []User{} declares.
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Slice {
+		return reflect.SliceOf(indirectType(t.Elem()))
+	}
+
+	return t
+}
@@ -0,0 +1,143 @@
+package gomux
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hunterdishner/errors"
+)
+
+const defaultDrainTimeout = 30 * time.Second
+
+// DrainTimeout sets how long in-flight requests get to finish once the server's context is cancelled, after
+// which remaining connections are closed. Defaults to 30 seconds.
+func DrainTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.drain.timeout = d
+	}
+}
+
+// DrainClass gives the routes of a drain class their own deadline on shutdown: when it passes, the context of
+// every request still running in the class is cancelled. A timeout of zero cuts the class off as soon as the
+// drain starts, e.g. for long-poll GETs, while a class of payment POSTs can be allowed longer than the
+// DrainTimeout of the rest of the server.
+func DrainClass(name string, timeout time.Duration) Option {
+	return func(s *Server) {
+		s.drain.classes[name] = timeout
+	}
+}
+
+// InDrainClass puts each of the given routes in the named drain class.
+func InDrainClass(name string, routes ...Route) []Route {
+	for i := range routes {
+		routes[i].DrainClass = name
+	}
+
+	return routes
+}
+
+type drainer struct {
+	timeout time.Duration
+	classes map[string]time.Duration
+
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+	ctxs    map[string]context.Context
+}
+
+func newDrainer() *drainer {
+	return &drainer{
+		timeout: defaultDrainTimeout,
+		classes: map[string]time.Duration{},
+		cancels: map[string]context.CancelFunc{},
+		ctxs:    map[string]context.Context{},
+	}
+}
+
+// class returns the context cancelled when the named class hits its drain deadline.
+func (d *drainer) class(name string) context.Context {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if ctx, ok := d.ctxs[name]; ok {
+		return ctx
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.ctxs[name], d.cancels[name] = ctx, cancel
+	return ctx
+}
+
+// track ties the context of every request served by next to the drain deadline of its class.
+func (d *drainer) track(name string, next http.Handler) http.Handler {
+	classCtx := d.class(name)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		stop := context.AfterFunc(classCtx, cancel)
+		defer stop()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// timeoutOf resolves the deadline of a class, falling back to the server wide timeout.
+func (d *drainer) timeoutOf(name string) time.Duration {
+	if t, ok := d.classes[name]; ok {
+		return t
+	}
+
+	return d.timeout
+}
+
+// longest is the time the whole drain may take.
+func (d *drainer) longest() time.Duration {
+	longest := d.timeout
+	for _, t := range d.classes {
+		if t > longest {
+			longest = t
+		}
+	}
+
+	return longest
+}
+
+// drainOnDone shuts srv down once ctx, the server's context or one derived from it, is cancelled. The returned
+// channel is closed when the drain has finished.
+func (s *Server) drainOnDone(ctx context.Context, srv *http.Server) <-chan struct{} {
+	drained := make(chan struct{})
+
+	go func() {
+		defer close(drained)
+		<-ctx.Done()
+
+		// A Host drains the classes of every server it mounts along with its own.
+		longest := time.Duration(0)
+		for _, srv := range append([]*Server{s}, s.mounts...) {
+			d := srv.drain
+			d.mu.Lock()
+			for name, cancel := range d.cancels {
+				time.AfterFunc(d.timeoutOf(name), cancel)
+			}
+			d.mu.Unlock()
+
+			if l := d.longest(); l > longest {
+				longest = l
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), longest)
+		defer cancel()
+
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("%+v", errors.E(errors.HTTP, errors.CodeServerError, err))
+			srv.Close()
+		}
+	}()
+
+	return drained
+}
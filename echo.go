@@ -0,0 +1,106 @@
+package gomux
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// DeploymentSlot tags every response with an X-Deployment-Slot header naming the deployment color or slot the
+// server runs in, e.g. "blue" or "green", so it is clear which one answered a request.
+func DeploymentSlot(slot string) Option {
+	return func(s *Server) {
+		s.slot = slot
+		s.middleware = append(s.middleware, func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Deployment-Slot", slot)
+				next.ServeHTTP(w, r)
+			})
+		})
+	}
+}
+
+// EchoInfo is what the server sees of a request, as returned by Echo.
+type EchoInfo struct {
+	Method     string `json:"method"`
+	Host       string `json:"host"`
+	URI        string `json:"uri"`
+	Proto      string `json:"proto"`
+	RemoteAddr string `json:"remote_addr"`
+	// ClientIP is the first X-Forwarded-For entry, or the remote address without one. It is whatever the
+	// proxies in front of the server passed on and is not verified.
+	ClientIP     string      `json:"client_ip"`
+	ForwardedFor []string    `json:"forwarded_for,omitempty"`
+	Header       http.Header `json:"header"`
+	Slot         string      `json:"slot,omitempty"`
+	TLS          *EchoTLS    `json:"tls,omitempty"`
+}
+
+// EchoTLS describes the TLS connection of a request.
+type EchoTLS struct {
+	Version            string `json:"version"`
+	CipherSuite        string `json:"cipher_suite"`
+	ServerName         string `json:"server_name,omitempty"`
+	NegotiatedProtocol string `json:"negotiated_protocol,omitempty"`
+	Resumed            bool   `json:"resumed"`
+	ClientCertificate  string `json:"client_certificate,omitempty"`
+}
+
+// echoRedacted lists the headers whose values Echo leaves out, so credentials scripts cannot read, such as
+// HttpOnly cookies, are not reflected back to them.
+var echoRedacted = []string{"Authorization", "Cookie", "Proxy-Authorization"}
+
+// Echo is a ServiceHandler returning what the server sees of the request: its headers, the client address
+// they resolve to and the TLS connection, for diagnosing proxy chains. Mount it like any other route,
+// preferably limited to some environments, e.g.
+// gomux.OnlyIn([]string{"staging"}, gomux.Get("/debug/echo", s.Echo)).
+func (s *Server) Echo(w io.Writer, r *http.Request) (interface{}, error) {
+	info := EchoInfo{
+		Method:     r.Method,
+		Host:       r.Host,
+		URI:        r.RequestURI,
+		Proto:      r.Proto,
+		RemoteAddr: r.RemoteAddr,
+		Header:     r.Header.Clone(),
+		Slot:       s.slot,
+	}
+
+	for _, h := range echoRedacted {
+		if _, ok := info.Header[h]; ok {
+			info.Header[h] = []string{"[redacted]"}
+		}
+	}
+
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		for _, ip := range strings.Split(v, ",") {
+			if ip = strings.TrimSpace(ip); ip != "" {
+				info.ForwardedFor = append(info.ForwardedFor, ip)
+			}
+		}
+	}
+
+	if len(info.ForwardedFor) > 0 {
+		info.ClientIP = info.ForwardedFor[0]
+	} else if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		info.ClientIP = host
+	} else {
+		info.ClientIP = r.RemoteAddr
+	}
+
+	if r.TLS != nil {
+		info.TLS = &EchoTLS{
+			Version:            tls.VersionName(r.TLS.Version),
+			CipherSuite:        tls.CipherSuiteName(r.TLS.CipherSuite),
+			ServerName:         r.TLS.ServerName,
+			NegotiatedProtocol: r.TLS.NegotiatedProtocol,
+			Resumed:            r.TLS.DidResume,
+		}
+		if len(r.TLS.PeerCertificates) > 0 {
+			info.TLS.ClientCertificate = r.TLS.PeerCertificates[0].Subject.String()
+		}
+	}
+
+	return info, nil
+}
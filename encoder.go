@@ -0,0 +1,87 @@
+package gomux
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/hunterdishner/errors"
+)
+
+// Encoder renders the results of ServiceHandlers into a response body.
+type Encoder interface {
+	// ContentType is the media type set on every response the encoder renders.
+	ContentType() string
+	// Encode writes the data returned by a successful handler.
+	Encode(w io.Writer, data interface{}) error
+	// EncodeError writes the error returned by a failed handler.
+	EncodeError(w io.Writer, err *errors.Error) error
+}
+
+var defaultEncoder Encoder = jsonEncoder{}
+
+// WithEncoder sets the encoder used by each of the given routes, e.g.
+// s.AddRoutes(gomux.WithEncoder(enc, gomux.Get("/users", Users), gomux.Get("/user/{id}", User))...).
+func WithEncoder(enc Encoder, routes ...Route) []Route {
+	for i := range routes {
+		routes[i].Encoder = enc
+	}
+
+	return routes
+}
+
+type jsonEncoder struct{}
+
+func (jsonEncoder) ContentType() string {
+	return "application/json"
+}
+
+func (jsonEncoder) Encode(w io.Writer, data interface{}) error {
+	return encodeJSON(w, data)
+}
+
+func (jsonEncoder) EncodeError(w io.Writer, err *errors.Error) error {
+	return encodeJSON(w, err)
+}
+
+// responseBuffer is a pooled buffer responses are encoded into, carrying a JSON encoder bound to it so the
+// built-in encoders allocate neither per response.
+type responseBuffer struct {
+	bytes.Buffer
+	enc *json.Encoder
+}
+
+// maxPooledBuffer keeps the buffers of unusually large responses out of the pool, so one export does not pin
+// its memory for good.
+const maxPooledBuffer = 64 << 10
+
+var responseBuffers = sync.Pool{
+	New: func() interface{} {
+		b := &responseBuffer{}
+		b.enc = json.NewEncoder(&b.Buffer)
+		return b
+	},
+}
+
+func getResponseBuffer() *responseBuffer {
+	return responseBuffers.Get().(*responseBuffer)
+}
+
+func putResponseBuffer(b *responseBuffer) {
+	if b.Cap() > maxPooledBuffer {
+		return
+	}
+
+	b.Reset()
+	responseBuffers.Put(b)
+}
+
+// encodeJSON writes v as JSON to w, using the encoder of w when it is a responseBuffer.
+func encodeJSON(w io.Writer, v interface{}) error {
+	if b, ok := w.(*responseBuffer); ok {
+		return b.enc.Encode(v)
+	}
+
+	return json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,70 @@
+package gomux
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hunterdishner/errors"
+)
+
+// discardResponse is a ResponseWriter that allocates nothing per response, so the benchmarks measure the
+// response path alone.
+type discardResponse struct {
+	header http.Header
+}
+
+func (w *discardResponse) Header() http.Header {
+	return w.header
+}
+
+func (w *discardResponse) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *discardResponse) WriteHeader(int) {}
+
+type benchUser struct {
+	ID    int      `json:"id"`
+	Name  string   `json:"name"`
+	Email string   `json:"email"`
+	Roles []string `json:"roles"`
+}
+
+func benchmarkRoute(b *testing.B, handler ServiceHandler) {
+	s := New(context.Background(), "bench")
+	h := s.responseHandler(Get("/users", handler))
+	r := httptest.NewRequest(http.MethodGet, "/bench/users", nil)
+	w := &discardResponse{header: http.Header{}}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.ServeHTTP(w, r)
+	}
+}
+
+func BenchmarkResponse(b *testing.B) {
+	user := benchUser{ID: 42, Name: "Ada Lovelace", Email: "ada@example.com", Roles: []string{"admin", "author"}}
+	benchmarkRoute(b, func(w io.Writer, r *http.Request) (interface{}, error) {
+		return user, nil
+	})
+}
+
+func BenchmarkResponseLarge(b *testing.B) {
+	users := make([]benchUser, 500)
+	for i := range users {
+		users[i] = benchUser{ID: i, Name: "Ada Lovelace", Email: "ada@example.com", Roles: []string{"admin", "author"}}
+	}
+	benchmarkRoute(b, func(w io.Writer, r *http.Request) (interface{}, error) {
+		return users, nil
+	})
+}
+
+func BenchmarkErrorResponse(b *testing.B) {
+	benchmarkRoute(b, func(w io.Writer, r *http.Request) (interface{}, error) {
+		return nil, errors.E(errors.Invalid, errors.CodeBadRequest, "name is required")
+	})
+}
@@ -0,0 +1,95 @@
+package gomux
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/hunterdishner/errors"
+)
+
+// ETags tags every ServiceHandler response with an ETag computed from its encoded body and answers GET and
+// HEAD requests whose If-None-Match matches with a 304.
+func ETags() Option {
+	return func(s *Server) {
+		s.etags = true
+	}
+}
+
+// ETag returns the entity tag v would be served with by a JSON route.
+func ETag(v interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := defaultEncoder.Encode(&buf, v); err != nil {
+		return "", errors.E(errors.Encoding, errors.CodeServerError, err)
+	}
+
+	return etagOf(buf.Bytes()), nil
+}
+
+// CheckIfMatch implements If-Match concurrency control for PUT and DELETE handlers: current is the resource as
+// it would be returned by its GET route, and a request whose If-Match names another version is rejected with
+// a 412. Requests without If-Match pass.
+func CheckIfMatch(r *http.Request, current interface{}) error {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return nil
+	}
+
+	tag, err := ETag(current)
+	if err != nil {
+		return err
+	}
+
+	if !etagMatches(header, tag, false) {
+		return errors.E(errors.Invalid, errors.Code(http.StatusPreconditionFailed), "resource has been modified")
+	}
+
+	return nil
+}
+
+// notModified sets the ETag header for body and writes a 304 when the request already holds it.
+func notModified(w http.ResponseWriter, r *http.Request, body []byte) bool {
+	tag := etagOf(body)
+	w.Header().Set("ETag", tag)
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	header := r.Header.Get("If-None-Match")
+	if header == "" || !etagMatches(header, tag, true) {
+		return false
+	}
+
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+func etagOf(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether tag is listed in an If-Match or If-None-Match header. Weak comparison ignores
+// the W/ prefix, as used for If-None-Match.
+func etagMatches(header, tag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == tag {
+			return true
+		}
+	}
+
+	return false
+}
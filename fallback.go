@@ -0,0 +1,129 @@
+package gomux
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/hunterdishner/errors"
+)
+
+func (s *Server) notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	writeError(w, r, defaultEncoder, errors.E(errors.Invalid, errors.Code(http.StatusNotFound), "no route matches "+r.URL.Path))
+}
+
+func (s *Server) methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	// The path may only match routes that are disabled, which are not there as far as clients can tell.
+	if len(s.allowedMethods(r)) == 0 {
+		s.notFound.ServeHTTP(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Allow", strings.Join(s.allow(r), ", "))
+	writeError(w, r, defaultEncoder, errors.E(errors.Invalid, errors.Code(http.StatusMethodNotAllowed), r.Method+" is not allowed on "+r.URL.Path))
+}
+
+// optionsHandler answers OPTIONS requests for mounted paths that have no OPTIONS route of their own.
+func (s *Server) optionsHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		methods := s.allowedMethods(r)
+		if len(methods) == 0 || contains(methods, http.MethodOptions) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Allow", strings.Join(append(methods, http.MethodOptions), ", "))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// allow returns the value of the Allow header for the request's path.
+func (s *Server) allow(r *http.Request) []string {
+	methods := s.allowedMethods(r)
+	if s.autoOptions && !contains(methods, http.MethodOptions) {
+		methods = append(methods, http.MethodOptions)
+	}
+
+	return methods
+}
+
+// allowedMethods returns the methods of every enabled route whose path matches the request, regardless of the
+// request's own method.
+func (s *Server) allowedMethods(r *http.Request) []string {
+	var methods []string
+	seen := map[string]bool{}
+
+	_ = s.mux.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		// Routes mounted other than by AddRoutes, e.g. profiling, have no methods to add.
+		re, ok := s.routePaths[route]
+		if !ok || !re.MatchString(r.URL.Path) {
+			return nil
+		}
+		if gate, ok := s.routeGates[route]; ok && !s.routeEnabled(gate, r) {
+			return nil
+		}
+
+		ms, _ := route.GetMethods()
+		for _, m := range ms {
+			if !seen[m] {
+				seen[m] = true
+				methods = append(methods, m)
+			}
+		}
+
+		return nil
+	})
+
+	return methods
+}
+
+// cachePath compiles the path regexp of a mounted route once, rather than on every request allowedMethods
+// serves.
+func (s *Server) cachePath(route *mux.Route) {
+	pattern, err := route.GetPathRegexp()
+	if err != nil {
+		return
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return
+	}
+
+	if s.routePaths == nil {
+		s.routePaths = map[*mux.Route]*regexp.Regexp{}
+	}
+	s.routePaths[route] = re
+}
+
+// headHandler runs a GET handler for a HEAD request, keeping its headers and status but dropping the body.
+func headHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(headWriter{w}, r)
+	})
+}
+
+type headWriter struct {
+	http.ResponseWriter
+}
+
+func (w headWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,148 @@
+package gomux
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hunterdishner/errors"
+)
+
+// FeatureFlags evaluates feature flags, e.g. backed by LaunchDarkly, Unleash or a config table. Routes are
+// served behind a flag with Flag.
+type FeatureFlags interface {
+	// Enabled reports whether flag is on for the request, which allows targeting by user or tenant.
+	Enabled(r *http.Request, flag string) bool
+}
+
+// Flags evaluates the flags of routes served behind one with ff.
+func Flags(ff FeatureFlags) Option {
+	return func(s *Server) {
+		s.flags = ff
+	}
+}
+
+// When serves each of the given routes only while enabled reports true, evaluated on every request, e.g.
+// gomux.When(maintenance.Off, gomux.Post("/orders", CreateOrder)). Requests to a disabled route are answered
+// with the route's DisabledStatus.
+func When(enabled func() bool, routes ...Route) []Route {
+	for i := range routes {
+		routes[i].Enabled = enabled
+	}
+
+	return routes
+}
+
+// Flag serves each of the given routes only while the feature flag is on, as evaluated by the server's Flags
+// on every request, e.g. gomux.Flag("beta-search", gomux.Get("/search", Search)). Without Flags every flag is
+// off. Requests to a disabled route are answered with the route's DisabledStatus.
+func Flag(flag string, routes ...Route) []Route {
+	for i := range routes {
+		routes[i].Flag = flag
+	}
+
+	return routes
+}
+
+// gated answers requests to the route with its DisabledStatus while it is disabled.
+func (s *Server) gated(route Route, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.routeEnabled(route, r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		switch route.DisabledStatus {
+		case 0, http.StatusNotFound:
+			s.notFound.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			writeError(w, r, defaultEncoder, errors.E(errors.HTTP, errors.Code(route.DisabledStatus), fmt.Sprintf("%s %s is not available", r.Method, r.URL.Path)))
+		}
+	})
+}
+
+// routeEnabled reports whether route is served for r, going by its Enabled and Flag.
+func (s *Server) routeEnabled(route Route, r *http.Request) bool {
+	enabled := route.Enabled == nil || route.Enabled()
+	if enabled && route.Flag != "" {
+		enabled = s.flags != nil && s.flags.Enabled(r, route.Flag)
+	}
+
+	return enabled
+}
+
+// FlagSet is FeatureFlags held in memory, on or off for every request alike. Flags it does not hold are off.
+// It can be changed at any time, by hand or from a source with RefreshFlags. The zero value holds no flags.
+type FlagSet struct {
+	mu    sync.RWMutex
+	flags map[string]bool
+}
+
+// NewFlagSet returns a FlagSet holding flags.
+func NewFlagSet(flags map[string]bool) *FlagSet {
+	f := &FlagSet{}
+	f.Replace(flags)
+	return f
+}
+
+func (f *FlagSet) Enabled(r *http.Request, flag string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.flags[flag]
+}
+
+// Set turns flag on or off.
+func (f *FlagSet) Set(flag string, on bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.flags == nil {
+		f.flags = map[string]bool{}
+	}
+	f.flags[flag] = on
+}
+
+// Replace swaps all flags for flags.
+func (f *FlagSet) Replace(flags map[string]bool) {
+	copied := make(map[string]bool, len(flags))
+	for flag, on := range flags {
+		copied[flag] = on
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.flags = copied
+}
+
+// RefreshFlags replaces the flags of set with what load returns, straight away and then every interval, while
+// the server serves. A failed load is logged and leaves the flags as they were. An interval that is not
+// positive is logged and nothing is refreshed.
+func (s *Server) RefreshFlags(set *FlagSet, interval time.Duration, load func(ctx context.Context) (map[string]bool, error)) {
+	if interval <= 0 {
+		log.Printf("%+v", errors.E(errors.Invalid, errors.CodeServerError, fmt.Sprintf("refresh feature flags: interval %s is not positive", interval)))
+		return
+	}
+
+	s.Go("flags", func(ctx context.Context) error {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			flags, err := load(ctx)
+			if err != nil {
+				log.Printf("%+v", errors.E(errors.IO, errors.CodeServerError, fmt.Sprintf("refresh feature flags: %v", err)))
+			} else {
+				set.Replace(flags)
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	})
+}
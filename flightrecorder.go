@@ -0,0 +1,229 @@
+package gomux
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"runtime/pprof"
+	"runtime/trace"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hunterdishner/errors"
+)
+
+// FlightRecorder adds the admin /flightrecorder endpoint. POST /flightrecorder?seconds=N records for N seconds,
+// at most max (defaults to 60s): an execution trace with a task per request, a log of every request, runtime
+// metrics each second and goroutine dumps at the start and end. GET /flightrecorder downloads the last
+// recording as a zip once it is done. It needs AdminPort.
+func FlightRecorder(max time.Duration) Option {
+	if max == 0 {
+		max = time.Minute
+	}
+
+	return func(s *Server) {
+		f := &flightRecorder{max: max, metrics: s.metrics}
+		s.flight = f
+		s.middleware = append(s.middleware, f.task)
+		s.responseHooks = append(s.responseHooks, f.record)
+	}
+}
+
+// maxFlightRequests caps the requests logged by one recording.
+const maxFlightRequests = 100000
+
+type flightRecorder struct {
+	max     time.Duration
+	metrics ServiceHandler
+
+	mu        sync.Mutex
+	recording bool
+	started   time.Time
+	until     time.Time
+	requests  []flightRequest
+	dropped   int
+	bundle    []byte
+}
+
+type flightRequest struct {
+	Start      time.Time `json:"start"`
+	Method     string    `json:"method"`
+	URI        string    `json:"uri"`
+	RemoteAddr string    `json:"remote_addr"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	Duration   string    `json:"duration"`
+}
+
+type flightStatus struct {
+	Status string    `json:"status"`
+	Until  time.Time `json:"until"`
+}
+
+// task runs each request in an execution trace task while a recording is running.
+func (f *flightRecorder) task(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !trace.IsEnabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, task := trace.NewTask(r.Context(), r.Method+" "+r.URL.Path)
+		defer task.End()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (f *flightRecorder) record(r *http.Request, info ResponseInfo) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.recording {
+		return
+	}
+	if len(f.requests) == maxFlightRequests {
+		f.dropped++
+		return
+	}
+
+	f.requests = append(f.requests, flightRequest{
+		Start:      time.Now().Add(-info.Duration),
+		Method:     r.Method,
+		URI:        r.RequestURI,
+		RemoteAddr: r.RemoteAddr,
+		Status:     info.Status,
+		Bytes:      info.Bytes,
+		Duration:   info.Duration.String(),
+	})
+}
+
+func (s *Server) flightRecorder(w io.Writer, r *http.Request) (interface{}, error) {
+	f := s.flight
+	switch r.Method {
+	case http.MethodGet:
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		switch {
+		case f.recording:
+			return nil, errors.E(errors.Invalid, errors.Code(http.StatusConflict), "recording until "+f.until.Format(time.RFC3339))
+		case f.bundle == nil:
+			return nil, errors.E(errors.Invalid, errors.Code(http.StatusNotFound), "nothing recorded")
+		}
+
+		name := fmt.Sprintf("flightrecorder-%s-%s.zip", s.name, f.started.UTC().Format("20060102T150405Z"))
+		return FileReader(bytes.NewReader(f.bundle), name, "application/zip"), nil
+	case http.MethodPost:
+	default:
+		return nil, errors.E(errors.Invalid, errors.Code(http.StatusMethodNotAllowed), "use GET or POST")
+	}
+
+	seconds, err := strconv.Atoi(r.URL.Query().Get("seconds"))
+	if err != nil || seconds <= 0 {
+		return nil, errors.E(errors.Invalid, errors.CodeBadRequest, "seconds must be a positive number")
+	}
+	d := time.Duration(seconds) * time.Second
+	if d > f.max {
+		d = f.max
+	}
+
+	until, err := f.start(d)
+	if err != nil {
+		return nil, err
+	}
+
+	return Respond(http.StatusAccepted, flightStatus{Status: "recording", Until: until}), nil
+}
+
+// start begins a recording of d and returns the time it ends.
+func (f *flightRecorder) start(d time.Duration) (time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.recording {
+		return time.Time{}, errors.E(errors.Invalid, errors.Code(http.StatusConflict), "already recording")
+	}
+
+	var execution, goroutinesStart bytes.Buffer
+	if err := trace.Start(&execution); err != nil {
+		return time.Time{}, errors.E(errors.Invalid, errors.Code(http.StatusConflict), err)
+	}
+	pprof.Lookup("goroutine").WriteTo(&goroutinesStart, 2)
+
+	f.recording, f.started, f.requests, f.dropped, f.bundle = true, time.Now(), nil, 0, nil
+	f.until = f.started.Add(d)
+	go f.run(d, &execution, &goroutinesStart)
+
+	return f.until, nil
+}
+
+// run samples the runtime metrics each second until d has passed, then stops the trace and builds the bundle.
+func (f *flightRecorder) run(d time.Duration, execution, goroutinesStart *bytes.Buffer) {
+	var metrics bytes.Buffer
+	enc := json.NewEncoder(&metrics)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	deadline := time.After(d)
+	for done := false; !done; {
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			done = true
+		}
+
+		m, _ := f.metrics(nil, nil)
+		enc.Encode(struct {
+			Time time.Time `json:"time"`
+			runtimeMetrics
+		}{time.Now(), m.(runtimeMetrics)})
+	}
+
+	var goroutinesEnd bytes.Buffer
+	pprof.Lookup("goroutine").WriteTo(&goroutinesEnd, 2)
+	trace.Stop()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var requests bytes.Buffer
+	enc = json.NewEncoder(&requests)
+	for _, req := range f.requests {
+		enc.Encode(req)
+	}
+	if f.dropped > 0 {
+		fmt.Fprintf(&requests, "{\"dropped\":%d}\n", f.dropped)
+	}
+
+	var bundle bytes.Buffer
+	zw := zip.NewWriter(&bundle)
+	for _, file := range []struct {
+		name string
+		data *bytes.Buffer
+	}{
+		{"trace.out", execution},
+		{"requests.jsonl", &requests},
+		{"metrics.jsonl", &metrics},
+		{"goroutines-start.txt", goroutinesStart},
+		{"goroutines-end.txt", &goroutinesEnd},
+	} {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: f.started})
+		if err == nil {
+			_, err = w.Write(file.data.Bytes())
+		}
+		if err != nil {
+			log.Printf("%+v", errors.E(errors.IO, errors.CodeServerError, err))
+			break
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("%+v", errors.E(errors.IO, errors.CodeServerError, err))
+	}
+
+	f.recording, f.requests, f.bundle = false, nil, bundle.Bytes()
+}
@@ -1,15 +1,19 @@
 package gomux
 
 import (
-	"bytes"
 	"context"
 	"crypto/tls"
-	"encoding/json"
+	"crypto/x509"
+	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/hunterdishner/errors"
@@ -24,7 +28,84 @@ type Server struct {
 	tls       bool
 	port      int
 	tlsconfig *tls.Config
+	certs     *certReloader
+	clientCAs *x509.CertPool
 	cors      *cors.Cors
+	routes    []mountedRoute
+
+	corsOptions cors.Options
+	nullOrigin  *bool
+
+	env       string
+	routeCors map[*mux.Route]*cors.Cors
+	// routeGates are the routes served behind When or Flag, left out of Allow while disabled.
+	routeGates map[*mux.Route]Route
+	// routePaths are the compiled path regexps of the mounted routes, matched for Allow and OPTIONS.
+	routePaths map[*mux.Route]*regexp.Regexp
+
+	middleware    []Middleware
+	responseHooks []ResponseHook
+	maxBodyBytes  int64
+	responseCheck ResponseCheck
+	etags         bool
+	latency       *latencyRecorder
+	backpressure  *backpressureRecorder
+	flight        *flightRecorder
+	drain         *drainer
+	cache         *CacheOptions
+	store         *embeddedStore
+	strict        bool
+	http2, h2c    bool
+	http3         bool
+	grpc          http.Handler
+	capabilities  *CapabilitiesOptions
+	minRate       *transferRate
+	timeouts      Timeouts
+	logLevel      string
+	slot          string
+
+	authScheme     string
+	authMiddleware Middleware
+	authReport     *AuthReportOptions
+	// unrouted are the endpoints served outside the routing table, e.g. the admin ones, for the auth report.
+	unrouted []RouteAuth
+
+	routeErrors       []string
+	failOnRouteErrors bool
+
+	notFound         http.Handler
+	methodNotAllowed http.Handler
+	autoOptions      bool
+	autoHead         bool
+
+	admin        *http.ServeMux
+	adminPort    int
+	adminAddress string
+	healthChecks map[string]HealthCheck
+	started      time.Time
+
+	profiling         bool
+	profilingUser     string
+	profilingPassword string
+	profilingSecret   string
+
+	secrets SecretProvider
+	flags   FeatureFlags
+
+	workers    *workerGroup
+	scheduleMu sync.Mutex
+	schedules  []*scheduledTask
+	webhooks   *webhookDispatcher
+	shed       *shedLimiter
+
+	idempotency *idempotency
+
+	// mounts are the servers a Host mounted on this one, drained along with it.
+	mounts []*Server
+
+	reusePort bool
+	listenMu  sync.Mutex
+	listeners map[string]net.Listener
 }
 
 type ServiceHandler func(io.Writer, *http.Request) (interface{}, error)
@@ -50,6 +131,45 @@ func CustomCors(cors *cors.Cors) Option {
 	}
 }
 
+// NotFoundHandler replaces the JSON 404 response served for paths that match no route.
+func NotFoundHandler(h http.Handler) Option {
+	return func(s *Server) {
+		s.notFound = h
+	}
+}
+
+// MethodNotAllowedHandler replaces the JSON 405 response served when a path matches a route but the method
+// does not.
+func MethodNotAllowedHandler(h http.Handler) Option {
+	return func(s *Server) {
+		s.methodNotAllowed = h
+	}
+}
+
+// AutoOptions answers OPTIONS requests on any mounted path with a 204 listing the allowed methods, unless
+// an OPTIONS route has been added for that path. CORS preflight requests are still handled by the cors
+// handler.
+func AutoOptions() Option {
+	return func(s *Server) {
+		s.autoOptions = true
+	}
+}
+
+// AutoHead answers HEAD requests for every GET route by running the GET handler and discarding the body.
+func AutoHead() Option {
+	return func(s *Server) {
+		s.autoHead = true
+	}
+}
+
+// Environment names the environment the server runs in (e.g. "dev", "prod"). Routes restricted with
+// OnlyIn are only mounted when their environments include it.
+func Environment(env string) Option {
+	return func(s *Server) {
+		s.env = env
+	}
+}
+
 func Port(p int) Option {
 	return func(s *Server) {
 		s.port = p
@@ -58,9 +178,13 @@ func Port(p int) Option {
 
 func New(ctx context.Context, name string, opts ...Option) *Server {
 	s := &Server{
-		name: name,
-		mux:  mux.NewRouter().StrictSlash(true).PathPrefix("/" + name).Subrouter(),
-		ctx:  ctx,
+		name:         name,
+		mux:          mux.NewRouter().StrictSlash(true).PathPrefix("/" + name).Subrouter(),
+		ctx:          ctx,
+		adminAddress: "localhost",
+		started:      time.Now(),
+		drain:        newDrainer(),
+		workers:      &workerGroup{},
 		tlsconfig: &tls.Config{
 			MinVersion:               tls.VersionTLS12,
 			CurvePreferences:         []tls.CurveID{tls.CurveP521, tls.CurveP384, tls.CurveP256},
@@ -72,26 +196,91 @@ func New(ctx context.Context, name string, opts ...Option) *Server {
 				tls.TLS_RSA_WITH_AES_256_CBC_SHA,
 			},
 		},
-		cors: cors.New(cors.Options{
+		corsOptions: cors.Options{
 			AllowedOrigins:   []string{"*"},
 			AllowCredentials: true,
-			AllowedMethods:   []string{"GET", "POST", "OPTIONS", "PUT", "DELETE"},
+			AllowedMethods:   []string{"GET", "POST", "OPTIONS", "PUT", "PATCH", "DELETE"},
 			AllowedHeaders:   []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		}),
+		},
 	}
 
+	s.notFound = http.HandlerFunc(s.notFoundHandler)
+	s.methodNotAllowed = http.HandlerFunc(s.methodNotAllowedHandler)
+
 	for _, opt := range opts {
 		opt(s)
 	}
 
+	if s.cors == nil {
+		s.cors = cors.New(s.defaultCorsOptions())
+	}
+
+	s.mux.NotFoundHandler = s.notFound
+	s.mux.MethodNotAllowedHandler = s.methodNotAllowed
+	s.mountAdmin()
+	s.mountProfiling()
+	s.mountCapabilities()
+
 	return s
 }
 
 type Route struct {
 	Method      string
 	Path        string
+	Name        string
 	Handler     ServiceHandler
 	HandlerFunc http.HandlerFunc
+	// Encoder renders the results of Handler. Defaults to plain JSON.
+	Encoder Encoder
+	// Cors overrides the server's CORS handling for this route.
+	Cors *cors.Cors
+	// Response declares the type Handler returns, e.g. User{} or []User{}. See CheckResponses.
+	Response interface{}
+	// MaxBodyBytes overrides the server's MaxBodyBytes for this route. A negative value removes the limit.
+	MaxBodyBytes int64
+	// CacheTTL caches the route's successful GET responses for the given duration. See Cache.
+	CacheTTL time.Duration
+	// Coalesce shares one handler execution between concurrent identical GET requests. See Coalesce.
+	Coalesce bool
+	// DrainClass groups the route with others that share a drain deadline on shutdown. See DrainClass.
+	DrainClass string
+	// Environments restricts the route to servers running in one of the listed environments. See Environment.
+	Environments []string
+	// Examples are the requests SelfTest sends to the route.
+	Examples []Example
+	// Upload limits what ReceiveUpload accepts on the route. See Uploads.
+	Upload *UploadOptions
+	// Middleware wraps the route's handler, inside the server's middleware. See Authenticate.
+	Middleware []Middleware
+	// Auth names the scheme authenticating the route, for the auth report. See Authenticate and ReportAuth.
+	Auth string
+	// Public marks the route as intentionally unauthenticated. See Public.
+	Public bool
+	// Enabled reports whether the route is served, evaluated on every request. See When.
+	Enabled func() bool
+	// Flag names the feature flag the route is served behind. See Flag.
+	Flag string
+	// DisabledStatus answers requests while the route is disabled by Enabled or Flag. Defaults to 404; 501
+	// tells clients the endpoint exists but is not available yet.
+	DisabledStatus int
+
+	// err is a failure building the route, reported by AddRoutes.
+	err error
+	// bulkhead and breaker are shared with the other routes of their group. See Bulkhead and Breaker.
+	bulkhead chan struct{}
+	breaker  *breaker
+	// audit records the route's mutating requests. See Audit.
+	audit *AuditOptions
+	// shed limits the requests the route handles at once. See ShedRoutes.
+	shed *shedLimiter
+	// coalesceScope further divides the requests Coalesce shares. See CoalesceBy.
+	coalesceScope func(r *http.Request) string
+}
+
+// Named returns a copy of the route with the given name so it can be referenced by Server.URL.
+func (r Route) Named(name string) Route {
+	r.Name = name
+	return r
 }
 
 // NewRoute is a convenience function to make calling AddRoutes simpler.
@@ -184,23 +373,148 @@ func PutFn(path string, handler http.HandlerFunc) Route {
 	}
 }
 
+// Patch is a convenience function for creating a route with the PATCH method. See ApplyPatch.
+func Patch(path string, handler ServiceHandler) Route {
+	return Route{
+		Method:  "PATCH",
+		Path:    path,
+		Handler: handler,
+	}
+}
+
+// PatchFn is a convenience function for creating a route with the PATCH method.
+func PatchFn(path string, handler http.HandlerFunc) Route {
+	return Route{
+		Method:      "PATCH",
+		Path:        path,
+		HandlerFunc: handler,
+	}
+}
+
 func (s *Server) AddRoutes(routes ...Route) *Server {
 	for _, route := range routes {
 		route.Path = "/" + strings.TrimPrefix(route.Path, "/")
-		if route.Handler != nil {
-			route.HandlerFunc = s.responseHandler(route.Handler)
+		if s.authMiddleware != nil && route.Auth == "" && !route.Public {
+			route = Authenticate(s.authScheme, s.authMiddleware, route)[0]
+		}
+		if len(route.Environments) > 0 && !contains(route.Environments, s.env) {
+			s.routes = append(s.routes, mountedRoute{Route: route})
+			continue
 		}
 
-		if err := s.mux.Methods(route.Method).Path(route.Path).HandlerFunc(route.HandlerFunc).GetError(); err != nil { //goes against how go does things but it works for this case and is relatively legible
+		if route.err != nil {
+			s.routeError(route, route.err)
+			continue
+		}
+
+		handler := s.routeHandler(route)
+		mr := s.mux.Path(route.Path).Handler(handler)
+		if route.Method != "" {
+			mr = mr.Methods(route.Method)
+		}
+		if route.Name != "" {
+			mr = mr.Name(route.Name)
+		}
+
+		if err := mr.GetError(); err != nil { //goes against how go does things but it works for this case and is relatively legible
 			//log error
-			log.Printf("%+v", errors.E(errors.Invalid, errors.Code(http.StatusUnprocessableEntity), err))
+			s.routeError(route, err)
+			continue
+		}
+
+		s.cachePath(mr)
+		if route.Cors != nil {
+			if s.routeCors == nil {
+				s.routeCors = map[*mux.Route]*cors.Cors{}
+			}
+			s.routeCors[mr] = route.Cors
+		}
+		gated := route.Enabled != nil || route.Flag != ""
+		if gated {
+			if s.routeGates == nil {
+				s.routeGates = map[*mux.Route]Route{}
+			}
+			s.routeGates[mr] = route
+		}
+
+		if s.autoHead && route.Method == http.MethodGet {
+			hr := s.mux.Methods(http.MethodHead).Path(route.Path).Handler(headHandler(handler))
+			if err := hr.GetError(); err != nil {
+				s.routeError(route, err)
+			} else {
+				s.cachePath(hr)
+				if route.Cors != nil {
+					s.routeCors[hr] = route.Cors
+				}
+				if gated {
+					s.routeGates[hr] = route
+				}
+			}
 		}
+
+		s.routes = append(s.routes, mountedRoute{Route: route, enabled: true})
 	}
 
 	return s
 }
 
+// Serve listens until the listener fails or the context given to New is cancelled. On cancellation the server
+// stops accepting connections, drains in-flight requests (see DrainTimeout and DrainClass) and returns nil.
 func (s *Server) Serve() error {
+	if s.failOnRouteErrors {
+		if err := s.Err(); err != nil {
+			return err
+		}
+	}
+
+	if err := s.checkAuth(); err != nil {
+		return err
+	}
+
+	// Deferred first so the store closes last, once requests are drained and workers stopped.
+	defer s.store.close()
+	defer s.workers.start(s.ctx, s.drain.longest())()
+
+	return s.serve(s.handler())
+}
+
+// Start runs the background workers registered with Go for a server used through Handler, as Serve does for
+// the servers it runs; it must not be called for those. The workers stop when ctx is cancelled or the returned
+// func is called, which waits for them as long as DrainTimeout allows and then closes the EmbeddedStore.
+func (s *Server) Start(ctx context.Context) (stop func()) {
+	stopWorkers := s.workers.start(ctx, s.drain.longest())
+
+	return func() {
+		stopWorkers()
+		s.store.close()
+	}
+}
+
+// serve serves h on the configured port, alongside the admin listener when one is configured, until either
+// of them fails. When one fails the other is shut down like on cancellation, and the first error is returned.
+func (s *Server) serve(h http.Handler) error {
+	if s.admin == nil {
+		return s.listen(s.ctx, h)
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+
+	errc := make(chan error, 2)
+	go func() { errc <- s.serveAdmin(ctx) }()
+	go func() { errc <- s.listen(ctx, h) }()
+
+	err := <-errc
+	cancel()
+	if err2 := <-errc; err == nil {
+		err = err2
+	}
+
+	return err
+}
+
+// listen listens on the configured port and serves h until ctx is cancelled.
+func (s *Server) listen(ctx context.Context, h http.Handler) error {
 	if s.port == 0 {
 		free, err := freeport.GetFreePort()
 		if err != nil {
@@ -210,59 +524,308 @@ func (s *Server) Serve() error {
 	}
 
 	srv := &http.Server{
-		Addr:         ":" + strconv.Itoa(s.port),
-		Handler:      s.cors.Handler(s.mux),
-		TLSConfig:    s.tlsconfig,
-		TLSNextProto: make(map[string]func(*http.Server, *tls.Conn, http.Handler)),
+		Addr:    ":" + strconv.Itoa(s.port),
+		Handler: h,
 	}
-
-	log.Printf("\n%s started on port %d\n", s.name, s.port)
+	certFile, keyFile := "server.crt", "server.key"
 	if s.tls {
-		return srv.ListenAndServeTLS("server.crt", "server.key")
+		srv.TLSConfig = s.tlsconfig
+		if s.certs != nil {
+			if err := s.certs.start(s.ctx); err != nil {
+				return err
+			}
+			srv.TLSConfig = s.certs.configure(s.tlsconfig)
+			certFile, keyFile = "", ""
+		}
+		if s.clientCAs != nil {
+			srv.TLSConfig = s.withClientAuth(srv.TLSConfig)
+			srv.Handler = clientIdentity(srv.Handler)
+		}
+	}
+	srv.ReadTimeout, srv.ReadHeaderTimeout = s.timeouts.Read, s.timeouts.ReadHeader
+	srv.WriteTimeout, srv.IdleTimeout = s.timeouts.Write, s.timeouts.Idle
+	if s.minRate != nil {
+		if srv.ReadHeaderTimeout == 0 {
+			srv.ReadHeaderTimeout = s.minRate.grace
+		}
+		srv.Handler = s.minRate.enforce(srv.Handler)
+	}
+	if s.grpc != nil {
+		srv.Handler = s.grpcHandler(srv.Handler)
+	}
+
+	if err := s.configureHTTP2(srv); err != nil {
+		return err
+	}
+
+	ln, err := s.listenTCP(srv.Addr)
+	if err != nil {
+		return err
 	}
 
-	return srv.ListenAndServe()
+	if s.http3 {
+		h3, err := s.serveHTTP3(srv)
+		if err != nil {
+			ln.Close()
+			return err
+		}
+		defer h3.Close()
+	}
+
+	if s.strict {
+		if ln, err = s.strictListener(srv, ln); err != nil {
+			return err
+		}
+	}
+
+	drained := s.drainOnDone(ctx, srv)
+
+	s.infof("\n%s started on port %d\n", s.name, s.port)
+	if s.tls && !s.strict {
+		err = srv.ServeTLS(ln, certFile, keyFile)
+	} else {
+		err = srv.Serve(ln)
+	}
+
+	if err == http.ErrServerClosed {
+		<-drained
+		return nil
+	}
+
+	return err
+}
+
+// serverTLSConfig returns a copy of the TLS config with its certificate loaded, for the listeners that
+// terminate TLS themselves rather than through ServeTLS.
+func (s *Server) serverTLSConfig() (*tls.Config, error) {
+	if s.certs != nil {
+		if err := s.certs.start(s.ctx); err != nil {
+			return nil, err
+		}
+		return s.withClientAuth(s.certs.configure(s.tlsconfig)), nil
+	}
+
+	cfg := &tls.Config{}
+	if s.tlsconfig != nil {
+		cfg = s.tlsconfig.Clone()
+	}
+
+	if len(cfg.Certificates) == 0 && cfg.GetCertificate == nil {
+		cert, err := tls.LoadX509KeyPair("server.crt", "server.key")
+		if err != nil {
+			return nil, errors.E(errors.CodeServerError, errors.IO, err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return s.withClientAuth(cfg), nil
+}
+
+// Handler returns the server's routes wrapped in its CORS handling, middleware and gRPC routing without
+// starting a listener, for mounting the server in an existing http.Server, a Lambda adapter or a test (see the
+// gomuxtest package). Options that configure the listener, such as Port, TLS, timeouts and MinTransferRate,
+// are left to whatever serves the handler; client certificate identities are still read from requests the
+// serving http.Server verified. The startup checks that make Serve fail are logged instead, and the background
+// workers registered with Go only run once Start is called.
+func (s *Server) Handler() http.Handler {
+	if err := s.checkAuth(); err != nil {
+		log.Printf("%+v", err)
+	}
+
+	return s.embeddable(s.handler())
+}
+
+// embeddable adds the handlers Serve wraps around h at the listener that work independently of it.
+func (s *Server) embeddable(h http.Handler) http.Handler {
+	if s.clientCAs != nil {
+		h = clientIdentity(h)
+	}
+	if s.grpc != nil {
+		h = s.grpcHandler(h)
+	}
+
+	return h
+}
+
+// handler composes the router with the server wide handlers wrapped around it.
+func (s *Server) handler() http.Handler {
+	return instrument(s.corsHandler(s.cors, s.routing()), s.responseHooks)
 }
 
-func (s *Server) responseHandler(fn ServiceHandler) http.HandlerFunc {
+// routing is the router wrapped in the server's middleware, without CORS handling.
+func (s *Server) routing() http.Handler {
+	var h http.Handler = s.mux
+	if s.autoOptions {
+		h = s.optionsHandler(h)
+	}
+
+	return chain(h, s.middleware...)
+}
+
+// routeHandler builds the handler mounted for a route, wrapping it in the route level handling.
+func (s *Server) routeHandler(route Route) http.Handler {
+	var h http.Handler = route.HandlerFunc
+	if route.Handler != nil {
+		h = s.responseHandler(route)
+	}
+
+	if route.Upload != nil {
+		h = withUpload(route.Upload, h)
+	}
+
+	if s.idempotency != nil && route.Upload == nil && (route.Method == http.MethodPost || route.Method == http.MethodPut) {
+		h = s.idempotent(route, h)
+	}
+
+	if limit := s.bodyLimit(route); limit > 0 {
+		h = limitBody(limit, h)
+	}
+
+	if route.bulkhead != nil || route.breaker != nil {
+		h = protect(route, h)
+	}
+
+	if route.Coalesce && route.Method == http.MethodGet {
+		h = coalesce("/"+s.name+route.Path, route.coalesceScope, h)
+	}
+
+	if s.cache != nil && route.CacheTTL > 0 && route.Method == http.MethodGet {
+		h = s.cached(route, h)
+	}
+
+	if route.audit != nil {
+		h = auditInner(route.audit, h)
+	}
+
+	h = chain(h, route.Middleware...)
+
+	if route.shed != nil {
+		h = route.shed.limit(h)
+	}
+
+	if route.audit != nil {
+		h = audited(route.audit, "/"+s.name+route.Path, h)
+	}
+
+	if s.latency != nil {
+		h = s.latency.measure(route.Method, "/"+s.name+route.Path, h)
+	}
+
+	if s.backpressure != nil {
+		h = s.backpressure.track(route.Method, "/"+s.name+route.Path, h)
+	}
+
+	if len(s.drain.classes) > 0 {
+		h = s.drain.track(route.DrainClass, h)
+	}
+
+	if route.Enabled != nil || route.Flag != "" {
+		h = s.gated(route, h)
+	}
+
+	return h
+}
+
+func (s *Server) responseHandler(route Route) http.HandlerFunc {
+	fn, enc := route.Handler, route.Encoder
+	if enc == nil {
+		enc = defaultEncoder
+	}
+
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Type", enc.ContentType())
 
 		data, err := fn(w, r)
-		if err != nil {
-			switch err := err.(type) {
-			case *errors.Error:
-				if err.Code == 0 {
-					err.Code = http.StatusInternalServerError
-				}
-				w.WriteHeader(int(err.Code))
-				data = err
-			default:
-				w.WriteHeader(int(errors.CodeServerError))
-				data = errors.E(errors.CodeServerError, errors.Invalid, err)
+		if raw, ok := data.(rawResponse); ok && err == nil {
+			if err := raw.serve(w, r); err != nil {
+				writeError(w, r, enc, err)
 			}
-		} else {
-			w.WriteHeader(http.StatusOK)
+			return
 		}
 
-		if err := writeContent(w, r, data); err != nil {
-			log.Printf("%+v", errors.E(errors.Invalid, errors.Code(http.StatusUnprocessableEntity), err))
+		status, data := successStatus(data)
+		if err == nil && (status < 100 || status > 599) {
+			err = errors.E(errors.Invalid, errors.CodeServerError, fmt.Sprintf("%s %s returned invalid status %d", route.Method, route.Path, status))
+		}
+		if err == nil {
+			err = s.checkResponse(route, data)
+		}
+
+		if err != nil {
+			writeError(w, r, enc, err)
+			return
+		}
+
+		if bodyless(status, data) {
+			w.Header().Del("Content-Type")
+			w.WriteHeader(status)
+			return
+		}
+
+		// Small bodies are buffered too: it is what lets an encoding failure still become an error response and
+		// ETags hash the body, and the pooled buffer costs no allocation, so there is no unbuffered path.
+		buf := getResponseBuffer()
+		defer putResponseBuffer(buf)
+		if err := enc.Encode(buf, data); err != nil {
+			writeError(w, r, enc, errors.E(errors.Encoding, errors.CodeServerError, err))
+			return
+		}
+
+		if s.etags && status == http.StatusOK && notModified(w, r, buf.Bytes()) {
+			return
+		}
+
+		w.WriteHeader(status)
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			log.Printf("%+v", errors.E(errors.IO, errors.CodeServerError, err))
 		}
 	}
 }
 
-func writeContent(w http.ResponseWriter, r *http.Request, data interface{}) error {
-	var buf bytes.Buffer
+// writeError writes err as an error envelope using the code it carries. Errors that are not of type
+// errors.Error are wrapped and reported as a 500.
+func writeError(w http.ResponseWriter, r *http.Request, enc Encoder, err error) {
+	if bodyErr := bodyError(err); bodyErr != nil {
+		err = bodyErr
+	}
 
-	if err := json.NewEncoder(&buf).Encode(data); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return errors.E(errors.Encoding, errors.CodeServerError, err)
+	if verr, ok := err.(*ValidationError); ok {
+		verr = translateFields(r, verr)
+		if fe, ok := enc.(FieldErrorEncoder); ok {
+			w.WriteHeader(http.StatusBadRequest)
+			if err := fe.EncodeFieldErrors(w, verr); err != nil {
+				log.Printf("%+v", errors.E(errors.Encoding, errors.CodeServerError, err))
+			}
+			return
+		}
+		err = errors.E(errors.Invalid, errors.CodeBadRequest, verr.Error())
 	}
 
-	if _, err := w.Write(buf.Bytes()); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return errors.E(errors.IO, errors.CodeServerError, err)
+	var e *errors.Error
+	switch err := err.(type) {
+	case *errors.Error:
+		if err.Code == 0 {
+			err.Code = http.StatusInternalServerError
+		}
+		e = err
+	default:
+		var ok bool
+		if e, ok = errors.E(errors.CodeServerError, errors.Invalid, err).(*errors.Error); !ok {
+			e = &errors.Error{Code: errors.CodeServerError}
+		}
 	}
+	e = translateError(r, e)
 
-	return nil
+	w.WriteHeader(int(e.Code))
+
+	buf := getResponseBuffer()
+	defer putResponseBuffer(buf)
+	if err := enc.EncodeError(buf, e); err != nil {
+		log.Printf("%+v", errors.E(errors.Encoding, errors.CodeServerError, err))
+		return
+	}
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		log.Printf("%+v", errors.E(errors.IO, errors.CodeServerError, err))
+	}
 }
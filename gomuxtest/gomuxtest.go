@@ -0,0 +1,119 @@
+// Package gomuxtest serves a gomux server in memory for handler tests. The server's whole handler chain, i.e.
+// CORS, middleware and error mapping, answers the requests, over a loopback listener picked by httptest.
+package gomuxtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hunterdishner/gomux"
+)
+
+// TestServer is a running test server. Close it when the test is done.
+type TestServer struct {
+	*httptest.Server
+	// Header is sent with every request made through Do, e.g. an Authorization header.
+	Header http.Header
+}
+
+// NewTestServer starts serving s.
+func NewTestServer(s *gomux.Server) *TestServer {
+	return &TestServer{Server: httptest.NewServer(s.Handler()), Header: http.Header{}}
+}
+
+// Response is the response to a request made through Do.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+	// JSON is the decoded body of JSON responses, nil for others.
+	JSON interface{}
+}
+
+// Do sends a request for path, including the server's name prefix, e.g. "/users/42", and reads the response.
+// A body of []byte, string or io.Reader is sent as is; anything else is encoded as JSON. Failures to send the
+// request end the test.
+func (ts *TestServer) Do(t testing.TB, method, path string, body interface{}) *Response {
+	t.Helper()
+
+	var r io.Reader
+	contentType := ""
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		r = bytes.NewReader(b)
+	case string:
+		r = strings.NewReader(b)
+	case io.Reader:
+		r = b
+	default:
+		encoded, err := json.Marshal(b)
+		if err != nil {
+			t.Fatalf("gomuxtest: encoding body of %s %s: %v", method, path, err)
+		}
+		r, contentType = bytes.NewReader(encoded), "application/json"
+	}
+
+	req, err := http.NewRequest(method, ts.URL+path, r)
+	if err != nil {
+		t.Fatalf("gomuxtest: %v", err)
+	}
+	for k, v := range ts.Header {
+		req.Header[k] = v
+	}
+	if contentType != "" && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	return ts.Request(t, req)
+}
+
+// Request sends req, which may use a relative URL, and reads the response.
+func (ts *TestServer) Request(t testing.TB, req *http.Request) *Response {
+	t.Helper()
+
+	if req.URL.Host == "" {
+		u := *req.URL
+		req.URL, req.Host = &u, ts.Listener.Addr().String()
+		req.URL.Scheme, req.URL.Host = "http", req.Host
+	}
+
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("gomuxtest: %s %s: %v", req.Method, req.URL.Path, err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("gomuxtest: reading response of %s %s: %v", req.Method, req.URL.Path, err)
+	}
+
+	res := &Response{Status: resp.StatusCode, Header: resp.Header, Body: b}
+	if mediatype, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); isJSON(mediatype) && len(b) > 0 {
+		if err := json.Unmarshal(b, &res.JSON); err != nil {
+			t.Fatalf("gomuxtest: decoding response of %s %s: %v", req.Method, req.URL.Path, err)
+		}
+	}
+
+	return res
+}
+
+// Decode decodes the body into v, ending the test when it does not fit.
+func (r *Response) Decode(t testing.TB, v interface{}) {
+	t.Helper()
+
+	if err := json.Unmarshal(r.Body, v); err != nil {
+		t.Fatalf("gomuxtest: decoding %q: %v", r.Body, err)
+	}
+}
+
+func isJSON(mediatype string) bool {
+	return mediatype == "application/json" || strings.HasSuffix(mediatype, "+json")
+}
@@ -0,0 +1,105 @@
+package gomuxtest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/hunterdishner/gomux"
+)
+
+type user struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func newTestServer(t *testing.T) *TestServer {
+	s := gomux.New(context.Background(), "users")
+	s.AddRoutes(
+		gomux.Get("/{id}", func(w io.Writer, r *http.Request) (interface{}, error) {
+			return user{ID: mux.Vars(r)["id"], Name: r.Header.Get("X-Name")}, nil
+		}),
+		gomux.Put("/{id}", func(w io.Writer, r *http.Request) (interface{}, error) {
+			var u user
+			if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+				return nil, err
+			}
+			u.ID = mux.Vars(r)["id"]
+			return u, nil
+		}),
+	)
+
+	ts := NewTestServer(s)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestDo(t *testing.T) {
+	ts := newTestServer(t)
+	ts.Header.Set("X-Name", "Ada")
+
+	res := ts.Do(t, http.MethodGet, "/users/42", nil)
+	if res.Status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", res.Status, http.StatusOK)
+	}
+
+	var got user
+	res.Decode(t, &got)
+	if want := (user{ID: "42", Name: "Ada"}); got != want {
+		t.Errorf("body = %+v, want %+v", got, want)
+	}
+	if m, ok := res.JSON.(map[string]interface{}); !ok || m["id"] != "42" {
+		t.Errorf("JSON = %#v, want the decoded user", res.JSON)
+	}
+}
+
+func TestDoEncodesJSONBody(t *testing.T) {
+	ts := newTestServer(t)
+
+	res := ts.Do(t, http.MethodPut, "/users/7", user{Name: "Grace"})
+	if res.Status != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", res.Status, http.StatusOK, res.Body)
+	}
+
+	var got user
+	res.Decode(t, &got)
+	if want := (user{ID: "7", Name: "Grace"}); got != want {
+		t.Errorf("body = %+v, want %+v", got, want)
+	}
+}
+
+func TestRequestRelativeURL(t *testing.T) {
+	ts := newTestServer(t)
+
+	req, err := http.NewRequest(http.MethodGet, "/users/42", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Name", "Ada")
+
+	res := ts.Request(t, req)
+	if res.Status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", res.Status, http.StatusOK)
+	}
+
+	var got user
+	res.Decode(t, &got)
+	if got.ID != "42" || got.Name != "Ada" {
+		t.Errorf("body = %+v, want user 42 named Ada", got)
+	}
+}
+
+func TestDoNotFound(t *testing.T) {
+	ts := newTestServer(t)
+
+	res := ts.Do(t, http.MethodGet, "/orders/1", nil)
+	if res.Status != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d", res.Status, http.StatusNotFound)
+	}
+	if res.JSON == nil {
+		t.Errorf("JSON is nil for the error envelope %q", res.Body)
+	}
+}
@@ -0,0 +1,33 @@
+package gomux
+
+import (
+	"net/http"
+	"strings"
+)
+
+// GRPC serves gRPC on the server's port next to its HTTP routes: HTTP/2 requests with an application/grpc
+// content type go to h, typically a *grpc.Server, and everything else to the routes. gRPC needs HTTP/2, so it
+// turns on HTTP2 for TLS listeners and H2C for plaintext ones; under StrictParsing TLS connections stay on
+// HTTP/1.1 and cannot carry it. gRPC requests skip the CORS handling, middleware and MinTransferRate but not
+// ServerTimeouts, whose Read and Write timeouts cut long streams short.
+//
+// grpc.Server's ServeHTTP lacks some features and performance of its own Serve; services depending on those
+// should keep gRPC on a port of its own.
+func GRPC(h http.Handler) Option {
+	return func(s *Server) {
+		s.grpc = h
+		s.http2, s.h2c = true, true
+	}
+}
+
+// grpcHandler sends gRPC requests to the GRPC handler and the rest to next.
+func (s *Server) grpcHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			s.grpc.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
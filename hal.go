@@ -0,0 +1,73 @@
+package gomux
+
+import (
+	"net/url"
+)
+
+// Link is a HAL link object.
+type Link struct {
+	Href string `json:"href"`
+}
+
+// Links is the _links member of a HAL resource. Add it to a response struct as a field tagged
+// json:"_links,omitempty".
+type Links map[string]Link
+
+// LinkBuilder builds Links from named routes so hrefs follow the routes' path templates. The first error
+// encountered is kept and returned by Build.
+type LinkBuilder struct {
+	s     *Server
+	links Links
+	err   error
+}
+
+// Links starts building a set of links against the server's named routes.
+func (s *Server) Links() *LinkBuilder {
+	return &LinkBuilder{s: s, links: Links{}}
+}
+
+// Self adds the "self" link pointing at the named route.
+func (b *LinkBuilder) Self(name string, params ...string) *LinkBuilder {
+	return b.Add("self", name, params...)
+}
+
+// Add adds a link with the given relation pointing at the named route. Params are the route's path variables
+// as key/value pairs, as for Server.URL.
+func (b *LinkBuilder) Add(rel, name string, params ...string) *LinkBuilder {
+	return b.AddQuery(rel, name, nil, params...)
+}
+
+// AddQuery adds a link to the named route with a query string, e.g. for "next" and "prev" page links.
+func (b *LinkBuilder) AddQuery(rel, name string, query url.Values, params ...string) *LinkBuilder {
+	if b.err != nil {
+		return b
+	}
+
+	href, err := b.s.URL(name, params...)
+	if err != nil {
+		b.err = err
+		return b
+	}
+
+	if len(query) > 0 {
+		href += "?" + query.Encode()
+	}
+
+	b.links[rel] = Link{Href: href}
+	return b
+}
+
+// Href adds a link with a literal href, for targets that are not routes on this server.
+func (b *LinkBuilder) Href(rel, href string) *LinkBuilder {
+	b.links[rel] = Link{Href: href}
+	return b
+}
+
+// Build returns the links, or the first error hit while resolving a route.
+func (b *LinkBuilder) Build() (Links, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	return b.links, nil
+}
@@ -0,0 +1,99 @@
+package gomux
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/hunterdishner/errors"
+)
+
+// Host serves several Servers on a single listener, each under its own name prefix. The listener settings
+// (Port, TLS, TLSConfig), the CORS handling (CustomCors, AllowedOrigins and the like) and the middleware come
+// from the Host's options and are shared by every mounted Server; the CORS options of the mounted servers are
+// not used, but their WithCors routes keep their own handling. CORS runs first, so preflights are answered
+// before the host's middleware, which runs before each server's own. Routing and the servers' own middleware
+// stay per service.
+type Host struct {
+	s       *Server
+	servers []*Server
+}
+
+// NewHost creates a Host configured with the same options as a Server.
+func NewHost(ctx context.Context, opts ...Option) *Host {
+	return &Host{s: New(ctx, "", opts...)}
+}
+
+// Mount adds servers to the host. A server whose name is already mounted is skipped.
+func (h *Host) Mount(servers ...*Server) *Host {
+	for _, srv := range servers {
+		if h.mounted(srv.name) {
+			log.Printf("%+v", errors.E(errors.Invalid, errors.Code(http.StatusUnprocessableEntity), "a server named "+srv.name+" is already mounted"))
+			continue
+		}
+
+		h.servers = append(h.servers, srv)
+	}
+
+	return h
+}
+
+// Serve starts the shared listener. With FailOnRouteErrors set on the host or a mounted server, it fails
+// instead when that server has invalid routes.
+func (h *Host) Serve() error {
+	for _, srv := range append([]*Server{h.s}, h.servers...) {
+		if h.s.failOnRouteErrors || srv.failOnRouteErrors {
+			if err := srv.Err(); err != nil {
+				return err
+			}
+		}
+		if err := srv.checkAuth(); err != nil {
+			return err
+		}
+	}
+
+	for _, srv := range append([]*Server{h.s}, h.servers...) {
+		defer srv.store.close()
+		defer srv.workers.start(srv.ctx, srv.drain.longest())()
+	}
+
+	h.s.mounts = h.servers
+	return h.s.serve(h.handler())
+}
+
+// Handler returns the mounted servers behind the host's middleware without starting a listener, like
+// Server.Handler.
+func (h *Host) Handler() http.Handler {
+	for _, srv := range append([]*Server{h.s}, h.servers...) {
+		if err := srv.checkAuth(); err != nil {
+			log.Printf("%+v", err)
+		}
+	}
+
+	return h.s.embeddable(h.handler())
+}
+
+func (h *Host) handler() http.Handler {
+	router := mux.NewRouter()
+	router.NotFoundHandler = h.s.cors.Handler(chain(h.s.notFound, h.s.middleware...))
+
+	for _, srv := range h.servers {
+		// CORS comes first, so preflights are answered before the host's middleware, e.g. authentication.
+		handler := instrument(srv.corsHandler(h.s.cors, chain(srv.routing(), h.s.middleware...)), srv.responseHooks)
+		router.Path("/" + srv.name).Handler(handler)
+		router.PathPrefix("/" + srv.name + "/").Handler(handler)
+	}
+
+	return instrument(router, h.s.responseHooks)
+}
+
+func (h *Host) mounted(name string) bool {
+	for _, srv := range h.servers {
+		if srv.name == name {
+			return true
+		}
+	}
+
+	return false
+}
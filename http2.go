@@ -0,0 +1,72 @@
+package gomux
+
+import (
+	"crypto/tls"
+	"net/http"
+
+	"github.com/hunterdishner/errors"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// HTTP2 serves HTTP/2 to TLS clients negotiating it through ALPN. HTTP/2 requires an ECDHE AES-128-GCM cipher
+// suite, which the default TLS config leaves out, so those are added when the config restricts its suites.
+// Under StrictParsing, TLS connections stay on HTTP/1.1.
+func HTTP2() Option {
+	return func(s *Server) {
+		s.http2 = true
+	}
+}
+
+// H2C serves cleartext HTTP/2 on plaintext listeners, both to clients with prior knowledge and to those
+// upgrading from HTTP/1.1, e.g. proxies and service meshes terminating TLS in front of the server.
+func H2C() Option {
+	return func(s *Server) {
+		s.h2c = true
+	}
+}
+
+// configureHTTP2 enables the HTTP/2 modes set on the server for srv, leaving it on HTTP/1.1 otherwise.
+func (s *Server) configureHTTP2(srv *http.Server) error {
+	overTLS := s.http2 && s.tls
+	cleartext := s.h2c && !s.tls
+	if !overTLS && !cleartext {
+		srv.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+		return nil
+	}
+
+	if overTLS && srv.TLSConfig != nil {
+		srv.TLSConfig = withHTTP2Ciphers(srv.TLSConfig)
+	}
+
+	// ConfigureServer also hooks the HTTP/2 connections into Shutdown, so they drain like the others.
+	h2s := &http2.Server{}
+	if err := http2.ConfigureServer(srv, h2s); err != nil {
+		return errors.E(errors.CodeServerError, errors.HTTP, err)
+	}
+
+	if cleartext {
+		srv.Handler = h2c.NewHandler(srv.Handler, h2s)
+	}
+
+	return nil
+}
+
+// withHTTP2Ciphers returns conf with the cipher suites HTTP/2 requires added, unless it already has one of
+// them or leaves the choice to crypto/tls.
+func withHTTP2Ciphers(conf *tls.Config) *tls.Config {
+	if conf.CipherSuites == nil {
+		return conf
+	}
+
+	for _, cs := range conf.CipherSuites {
+		if cs == tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 || cs == tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+			return conf
+		}
+	}
+
+	conf = conf.Clone()
+	conf.CipherSuites = append([]uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}, conf.CipherSuites...)
+
+	return conf
+}
@@ -0,0 +1,52 @@
+package gomux
+
+import (
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/hunterdishner/errors"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// HTTP3 additionally serves the routes over HTTP/3 on the UDP side of the server's port, sharing its TLS
+// config, and advertises it to TCP clients with an Alt-Svc header. It needs TLS. Support is experimental:
+// HTTP/3 connections are closed once the TCP side has drained rather than drained themselves.
+func HTTP3() Option {
+	return func(s *Server) {
+		s.http3 = true
+	}
+}
+
+// serveHTTP3 starts serving the handler of srv over QUIC and has srv advertise it.
+func (s *Server) serveHTTP3(srv *http.Server) (*http3.Server, error) {
+	if !s.tls {
+		return nil, errors.E(errors.Invalid, errors.CodeServerError, "gomux: HTTP3 needs TLS")
+	}
+
+	cfg, err := s.serverTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenPacket("udp", srv.Addr)
+	if err != nil {
+		return nil, errors.E(errors.CodeServerError, errors.IO, err)
+	}
+
+	h3 := &http3.Server{Addr: srv.Addr, Handler: srv.Handler, TLSConfig: cfg}
+	go func() {
+		if err := h3.Serve(conn); err != nil && err != http.ErrServerClosed {
+			log.Printf("%+v", errors.E(errors.CodeServerError, errors.HTTP, err))
+		}
+		conn.Close()
+	}()
+
+	next := srv.Handler
+	srv.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h3.SetQuicHeaders(w.Header())
+		next.ServeHTTP(w, r)
+	})
+
+	return h3, nil
+}
@@ -0,0 +1,227 @@
+package gomux
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hunterdishner/errors"
+)
+
+// IdempotencyOptions configures Idempotency. Zero values fall back to the defaults noted on each field.
+type IdempotencyOptions struct {
+	// Store keeps the responses. Defaults to the "idempotency" bucket of the EmbeddedStore, or an in-memory
+	// store of 10000 keys without one, which only suits single instances.
+	Store CacheStore
+	// TTL is how long responses are replayed. Defaults to 24 hours.
+	TTL time.Duration
+	// LockTTL bounds how long a request holds its key while in flight, in case the instance dies. Defaults to a
+	// minute.
+	LockTTL time.Duration
+	// Header defaults to "Idempotency-Key".
+	Header string
+	// Scope namespaces keys, e.g. by API key or tenant, so clients cannot replay each other's responses.
+	Scope func(r *http.Request) string
+	// MaxBodyBytes caps the bodies buffered to fingerprint them, answering larger ones with a 413. Defaults to
+	// the route's body limit, or 1MB when there is none.
+	MaxBodyBytes int64
+}
+
+// Idempotency honors an Idempotency-Key header on POST and PUT requests: the first response for a key is stored
+// and replayed, with an Idempotent-Replayed header, to retries carrying the same key and body. A retry while
+// the first request is still running is answered with a 409 and reusing a key for another body with a 422.
+// 5xx responses are not stored, so they can be retried. It applies to every POST and PUT route except upload
+// routes, whose bodies are streamed, and runs inside the route's middleware and body limit.
+//
+// Stores shared between instances only see a key as taken once its first request wrote its lock, so
+// duplicates arriving at different instances at the same moment can both run.
+func Idempotency(opts IdempotencyOptions) Option {
+	if opts.TTL == 0 {
+		opts.TTL = 24 * time.Hour
+	}
+	if opts.LockTTL == 0 {
+		opts.LockTTL = time.Minute
+	}
+	if opts.Header == "" {
+		opts.Header = "Idempotency-Key"
+	}
+
+	return func(s *Server) {
+		s.idempotency = &idempotency{opts: opts, inflight: map[string]bool{}}
+	}
+}
+
+// idempotencyMaxBody caps the bodies fingerprinted on routes without a body limit.
+const idempotencyMaxBody = 1 << 20
+
+type idempotency struct {
+	opts      IdempotencyOptions
+	storeOnce sync.Once
+
+	mu       sync.Mutex
+	inflight map[string]bool
+}
+
+// idempotent wraps the handler of a POST or PUT route, resolving the store on first use, once every option,
+// including EmbeddedStore, has been applied.
+func (s *Server) idempotent(route Route, next http.Handler) http.Handler {
+	i := s.idempotency
+	i.storeOnce.Do(func() {
+		if i.opts.Store == nil && s.store != nil {
+			store, err := s.Store("idempotency")
+			if err != nil {
+				log.Printf("%+v", err)
+			} else {
+				i.opts.Store = store
+			}
+		}
+		if i.opts.Store == nil {
+			i.opts.Store = NewMemoryCache(10000)
+		}
+	})
+
+	limit := i.opts.MaxBodyBytes
+	if limit <= 0 {
+		if limit = s.bodyLimit(route); limit <= 0 {
+			limit = idempotencyMaxBody
+		}
+	}
+
+	return i.handler(limit, next)
+}
+
+type idempotentEntry struct {
+	Fingerprint string          `json:"fingerprint"`
+	Pending     bool            `json:"pending,omitempty"`
+	Response    *cachedResponse `json:"response,omitempty"`
+}
+
+func (i *idempotency) handler(limit int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(i.opts.Header)
+		if key == "" || r.Method != http.MethodPost && r.Method != http.MethodPut {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		fingerprint, err := i.fingerprint(w, r, limit)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			writeError(w, r, defaultEncoder, err)
+			return
+		}
+
+		scope := ""
+		if i.opts.Scope != nil {
+			scope = i.opts.Scope(r)
+		}
+		// The trailing NUL keeps DeletePrefix from matching keys that merely start with this one.
+		storeKey := scope + "\x00" + r.Method + " " + r.URL.Path + "\x00" + key + "\x00"
+
+		if !i.lock(storeKey) {
+			i.conflict(w, r)
+			return
+		}
+		defer i.unlock(storeKey)
+
+		ctx := r.Context()
+		if b, ok, err := i.opts.Store.Get(ctx, storeKey); err != nil {
+			log.Printf("%+v", errors.E(errors.IO, errors.CodeServerError, err))
+		} else if ok {
+			var entry idempotentEntry
+			if err := json.Unmarshal(b, &entry); err == nil {
+				switch {
+				case entry.Fingerprint != fingerprint:
+					w.Header().Set("Content-Type", "application/json")
+					writeError(w, r, defaultEncoder, errors.E(errors.Invalid, errors.Code(http.StatusUnprocessableEntity), "idempotency key was used for another request"))
+					return
+				case entry.Pending:
+					i.conflict(w, r)
+					return
+				case entry.Response != nil:
+					for k, v := range entry.Response.Header {
+						w.Header()[k] = v
+					}
+					w.Header().Set("Idempotent-Replayed", "true")
+					w.WriteHeader(entry.Response.Status)
+					w.Write(entry.Response.Body)
+					return
+				}
+			}
+		}
+
+		i.set(ctx, storeKey, idempotentEntry{Fingerprint: fingerprint, Pending: true}, i.opts.LockTTL)
+
+		before := w.Header().Clone()
+		rec := &captureWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		// The outcome is recorded even when the client has gone, so its retries do not find the key locked.
+		ctx = context.WithoutCancel(ctx)
+		if rec.status >= 500 {
+			if err := i.opts.Store.DeletePrefix(ctx, storeKey); err != nil {
+				log.Printf("%+v", errors.E(errors.IO, errors.CodeServerError, err))
+			}
+			return
+		}
+
+		i.set(ctx, storeKey, idempotentEntry{
+			Fingerprint: fingerprint,
+			Response:    &cachedResponse{Status: rec.status, Header: handlerHeader(before, w.Header()), Body: rec.body.Bytes()},
+		}, i.opts.TTL)
+	})
+}
+
+// fingerprint hashes the request body, buffering up to limit bytes of it for the handler.
+func (i *idempotency) fingerprint(w http.ResponseWriter, r *http.Request, limit int64) (string, error) {
+	b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		if bodyErr := bodyError(err); bodyErr != nil {
+			return "", bodyErr
+		}
+		return "", errors.E(errors.IO, errors.CodeBadRequest, err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(b))
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (i *idempotency) lock(key string) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.inflight[key] {
+		return false
+	}
+	i.inflight[key] = true
+	return true
+}
+
+func (i *idempotency) unlock(key string) {
+	i.mu.Lock()
+	delete(i.inflight, key)
+	i.mu.Unlock()
+}
+
+func (i *idempotency) set(ctx context.Context, key string, entry idempotentEntry, ttl time.Duration) {
+	b, err := json.Marshal(entry)
+	if err == nil {
+		err = i.opts.Store.Set(ctx, key, b, ttl)
+	}
+	if err != nil {
+		log.Printf("%+v", errors.E(errors.IO, errors.CodeServerError, err))
+	}
+}
+
+func (i *idempotency) conflict(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	writeError(w, r, defaultEncoder, errors.E(errors.Invalid, errors.Code(http.StatusConflict), "a request with this idempotency key is in progress"))
+}
@@ -0,0 +1,229 @@
+package gomux
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/hunterdishner/errors"
+)
+
+// JSONAPIResource is implemented by values rendered by JSONAPIEncoder. Every exported field that encodes to
+// JSON, other than "id", becomes an attribute of the resource.
+type JSONAPIResource interface {
+	JSONAPIType() string
+	JSONAPIID() string
+}
+
+// JSONAPIRelated is implemented by resources that have relationships. Each value in the map is either a
+// JSONAPIResource (to-one), a slice of JSONAPIResource implementations such as []*User (to-many) or nil, typed
+// or not (an empty to-one relationship).
+type JSONAPIRelated interface {
+	JSONAPIRelationships() map[string]interface{}
+}
+
+// JSONAPIIncluder is implemented by resources that want related resources sent in the compound document's
+// "included" member.
+type JSONAPIIncluder interface {
+	JSONAPIIncluded() []JSONAPIResource
+}
+
+// JSONAPIEncoder renders responses as JSON:API documents. Handlers return a JSONAPIResource, a slice of them,
+// or nil.
+var JSONAPIEncoder Encoder = jsonAPIEncoder{}
+
+// JSONAPI is a convenience function for serving a group of routes with JSONAPIEncoder.
+func JSONAPI(routes ...Route) []Route {
+	return WithEncoder(JSONAPIEncoder, routes...)
+}
+
+type jsonAPIDocument struct {
+	Data     interface{}       `json:"data"`
+	Included []jsonAPIResource `json:"included,omitempty"`
+}
+
+type jsonAPIErrors struct {
+	Errors []jsonAPIErrorItem `json:"errors"`
+}
+
+type jsonAPIIdentifier struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type jsonAPIResource struct {
+	jsonAPIIdentifier
+	Attributes    map[string]json.RawMessage     `json:"attributes,omitempty"`
+	Relationships map[string]jsonAPIRelationship `json:"relationships,omitempty"`
+}
+
+type jsonAPIRelationship struct {
+	Data interface{} `json:"data"`
+}
+
+type jsonAPIErrorItem struct {
+	Status string              `json:"status"`
+	Title  string              `json:"title"`
+	Detail string              `json:"detail,omitempty"`
+	Source *jsonAPIErrorSource `json:"source,omitempty"`
+}
+
+type jsonAPIErrorSource struct {
+	Pointer string `json:"pointer"`
+}
+
+type jsonAPIEncoder struct{}
+
+func (jsonAPIEncoder) ContentType() string {
+	return "application/vnd.api+json"
+}
+
+func (jsonAPIEncoder) Encode(w io.Writer, data interface{}) error {
+	doc := jsonAPIDocument{}
+	included := map[jsonAPIIdentifier]bool{}
+
+	switch v := reflect.ValueOf(data); {
+	case isNil(data) && v.Kind() != reflect.Slice:
+	case v.Kind() == reflect.Slice:
+		resources := make([]jsonAPIResource, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if isNil(v.Index(i).Interface()) {
+				return fmt.Errorf("element %d of %T is nil", i, data)
+			}
+			res, err := jsonAPIResourceFor(v.Index(i).Interface(), &doc, included)
+			if err != nil {
+				return err
+			}
+			resources = append(resources, res)
+		}
+		doc.Data = resources
+	default:
+		res, err := jsonAPIResourceFor(data, &doc, included)
+		if err != nil {
+			return err
+		}
+		doc.Data = res
+	}
+
+	return encodeJSON(w, doc)
+}
+
+func (jsonAPIEncoder) EncodeError(w io.Writer, err *errors.Error) error {
+	return encodeJSON(w, jsonAPIErrors{
+		Errors: []jsonAPIErrorItem{{
+			Status: strconv.Itoa(int(err.Code)),
+			Title:  http.StatusText(int(err.Code)),
+			Detail: err.Error(),
+		}},
+	})
+}
+
+func (jsonAPIEncoder) EncodeFieldErrors(w io.Writer, err *ValidationError) error {
+	items := make([]jsonAPIErrorItem, 0, len(err.Fields))
+	for _, f := range err.Fields {
+		pointer := "/data/attributes/" + strings.NewReplacer(".", "/", "[", "/", "]", "").Replace(f.Field)
+		items = append(items, jsonAPIErrorItem{
+			Status: strconv.Itoa(http.StatusBadRequest),
+			Title:  http.StatusText(http.StatusBadRequest),
+			Detail: f.Field + " " + f.Message,
+			Source: &jsonAPIErrorSource{Pointer: pointer},
+		})
+	}
+
+	return encodeJSON(w, jsonAPIErrors{Errors: items})
+}
+
+// jsonAPIResourceFor converts v into a resource object, appending anything it includes to doc.
+func jsonAPIResourceFor(v interface{}, doc *jsonAPIDocument, included map[jsonAPIIdentifier]bool) (jsonAPIResource, error) {
+	r, ok := v.(JSONAPIResource)
+	if !ok {
+		return jsonAPIResource{}, fmt.Errorf("%T does not implement JSONAPIResource", v)
+	}
+
+	res := jsonAPIResource{jsonAPIIdentifier: jsonAPIIdentifier{Type: r.JSONAPIType(), ID: r.JSONAPIID()}}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return jsonAPIResource{}, err
+	}
+	if err := json.Unmarshal(b, &res.Attributes); err != nil {
+		return jsonAPIResource{}, fmt.Errorf("attributes of %T must encode to a JSON object: %w", v, err)
+	}
+	delete(res.Attributes, "id")
+
+	if rel, ok := r.(JSONAPIRelated); ok {
+		res.Relationships = map[string]jsonAPIRelationship{}
+		for name, related := range rel.JSONAPIRelationships() {
+			data, err := jsonAPILinkage(related)
+			if err != nil {
+				return jsonAPIResource{}, fmt.Errorf("relationship %q of %T: %w", name, v, err)
+			}
+			res.Relationships[name] = jsonAPIRelationship{Data: data}
+		}
+	}
+
+	if inc, ok := r.(JSONAPIIncluder); ok {
+		for _, rr := range inc.JSONAPIIncluded() {
+			if isNil(rr) {
+				continue
+			}
+			id := jsonAPIIdentifier{Type: rr.JSONAPIType(), ID: rr.JSONAPIID()}
+			if included[id] {
+				continue
+			}
+			included[id] = true
+
+			ir, err := jsonAPIResourceFor(rr, doc, included)
+			if err != nil {
+				return jsonAPIResource{}, err
+			}
+			doc.Included = append(doc.Included, ir)
+		}
+	}
+
+	return res, nil
+}
+
+// jsonAPILinkage returns the resource linkage of a relationship: nil for an empty to-one, an identifier for a
+// to-one and a list of them for a to-many.
+func jsonAPILinkage(related interface{}) (interface{}, error) {
+	v := reflect.ValueOf(related)
+	if v.Kind() != reflect.Slice {
+		if isNil(related) {
+			return nil, nil
+		}
+		if r, ok := related.(JSONAPIResource); ok {
+			return jsonAPIIdentifier{Type: r.JSONAPIType(), ID: r.JSONAPIID()}, nil
+		}
+		return nil, fmt.Errorf("unsupported type %T", related)
+	}
+
+	ids := make([]jsonAPIIdentifier, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		r, ok := v.Index(i).Interface().(JSONAPIResource)
+		if !ok || isNil(r) {
+			return nil, fmt.Errorf("element %d of %T is not a JSONAPIResource", i, related)
+		}
+		ids = append(ids, jsonAPIIdentifier{Type: r.JSONAPIType(), ID: r.JSONAPIID()})
+	}
+
+	return ids, nil
+}
+
+// isNil reports whether v is nil or a nil pointer, map, slice, func or interface held in an interface.
+func isNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Func, reflect.Interface, reflect.Chan:
+		return rv.IsNil()
+	}
+
+	return false
+}
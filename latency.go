@@ -0,0 +1,188 @@
+package gomux
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	latencyBuckets    = 96
+	latencyMin        = 100 * time.Microsecond
+	latencyGrowth     = 1.2
+	latencyMinSamples = 1000
+)
+
+// TimeoutSuggestion is the latency profile recorded for a route along with the timeout it suggests.
+type TimeoutSuggestion struct {
+	Method  string `json:"method"`
+	Path    string `json:"path"`
+	Samples uint64 `json:"samples"`
+	P50     string `json:"p50"`
+	P99     string `json:"p99"`
+	P999    string `json:"p999"`
+	// Suggested is p99.9 plus the configured margin, or empty while there are too few samples to tell.
+	Suggested string `json:"suggested,omitempty"`
+}
+
+// SuggestTimeouts records a latency histogram per route and suggests a timeout for each of them of p99.9 plus
+// margin (e.g. 0.25 for 25%). Suggestions are served by the admin /timeouts endpoint and TimeoutSuggestions.
+func SuggestTimeouts(margin float64) Option {
+	return func(s *Server) {
+		s.latency = &latencyRecorder{margin: margin, routes: map[string]*latencyHistogram{}}
+	}
+}
+
+// TimeoutSuggestions returns the suggestions for every route that has served a request, sorted by path. It is
+// empty unless SuggestTimeouts is set.
+func (s *Server) TimeoutSuggestions() []TimeoutSuggestion {
+	if s.latency == nil {
+		return nil
+	}
+
+	return s.latency.suggestions()
+}
+
+func (s *Server) timeoutSuggestions(w io.Writer, r *http.Request) (interface{}, error) {
+	return s.TimeoutSuggestions(), nil
+}
+
+type latencyRecorder struct {
+	margin float64
+
+	mu     sync.RWMutex
+	routes map[string]*latencyHistogram
+}
+
+type latencyHistogram struct {
+	method, path string
+	buckets      [latencyBuckets]uint64
+}
+
+// measure wraps the handler of a route so every request it serves is recorded under the request's method, as
+// the handler also serves HEAD for AutoHead and every method for routes without one. Other methods are
+// recorded under the route's.
+func (l *latencyRecorder) measure(method, path string, next http.Handler) http.Handler {
+	routeHist := l.histogram(method, path)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hist := routeHist
+		if r.Method != method && standardMethod(r.Method) {
+			hist = l.histogram(r.Method, path)
+		}
+
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		hist.record(time.Since(start))
+	})
+}
+
+// standardMethod reports whether m is one of the methods of RFC 9110 and PATCH, so clients sending made up
+// methods to routes without a method of their own cannot grow the recorder without bound.
+func standardMethod(m string) bool {
+	switch m {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+		http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+
+	return false
+}
+
+// histogram returns the histogram of method and path, adding it on first use.
+func (l *latencyRecorder) histogram(method, path string) *latencyHistogram {
+	key := method + " " + path
+
+	l.mu.RLock()
+	hist, ok := l.routes[key]
+	l.mu.RUnlock()
+	if ok {
+		return hist
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if hist, ok = l.routes[key]; !ok {
+		hist = &latencyHistogram{method: method, path: path}
+		l.routes[key] = hist
+	}
+
+	return hist
+}
+
+func (h *latencyHistogram) record(d time.Duration) {
+	i := 0
+	if d > latencyMin {
+		i = int(math.Ceil(math.Log(float64(d)/float64(latencyMin)) / math.Log(latencyGrowth)))
+	}
+	if i >= latencyBuckets {
+		i = latencyBuckets - 1
+	}
+
+	atomic.AddUint64(&h.buckets[i], 1)
+}
+
+// quantile returns the upper bound of the bucket holding the q quantile.
+func quantile(counts []uint64, total uint64, q float64) time.Duration {
+	rank := uint64(math.Ceil(q * float64(total)))
+	var seen uint64
+	for i, c := range counts {
+		seen += c
+		if seen >= rank {
+			return bucketBound(i)
+		}
+	}
+
+	return bucketBound(latencyBuckets - 1)
+}
+
+func bucketBound(i int) time.Duration {
+	return time.Duration(float64(latencyMin) * math.Pow(latencyGrowth, float64(i)))
+}
+
+func (l *latencyRecorder) suggestions() []TimeoutSuggestion {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	suggestions := make([]TimeoutSuggestion, 0, len(l.routes))
+	for _, h := range l.routes {
+		counts := make([]uint64, latencyBuckets)
+		var total uint64
+		for i := range h.buckets {
+			counts[i] = atomic.LoadUint64(&h.buckets[i])
+			total += counts[i]
+		}
+		if total == 0 {
+			continue
+		}
+
+		p999 := quantile(counts, total, 0.999)
+		ts := TimeoutSuggestion{
+			Method:  h.method,
+			Path:    h.path,
+			Samples: total,
+			P50:     quantile(counts, total, 0.5).Round(time.Microsecond).String(),
+			P99:     quantile(counts, total, 0.99).Round(time.Microsecond).String(),
+			P999:    p999.Round(time.Microsecond).String(),
+		}
+		if total >= latencyMinSamples {
+			suggested := time.Duration(float64(p999) * (1 + l.margin))
+			ts.Suggested = ((suggested + time.Millisecond - 1) / time.Millisecond * time.Millisecond).String()
+		}
+
+		suggestions = append(suggestions, ts)
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Path == suggestions[j].Path {
+			return suggestions[i].Method < suggestions[j].Method
+		}
+		return suggestions[i].Path < suggestions[j].Path
+	})
+
+	return suggestions
+}
@@ -0,0 +1,163 @@
+package gomux
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/hunterdishner/errors"
+)
+
+// ListOptions controls what ParseList accepts. Zero values fall back to the defaults noted on each field.
+type ListOptions struct {
+	// Sortable lists the fields sort may name.
+	Sortable []string
+	// Filterable lists the fields filter[field] may name.
+	Filterable []string
+	// DefaultSort applies when the request names none, e.g. "-created".
+	DefaultSort string
+	// DefaultLimit defaults to 20.
+	DefaultLimit int
+	// MaxLimit caps limit. Defaults to 100.
+	MaxLimit int
+}
+
+// ListParams are the paging, sorting and filtering parameters of a list request.
+type ListParams struct {
+	// Page is 1-based. It is 1 when a Cursor is given.
+	Page  int
+	Limit int
+	// Offset is the number of items before Page, for offset based storage.
+	Offset int
+	// Cursor is the opaque next_cursor of a previous page. It excludes page.
+	Cursor string
+	Sort   []SortField
+	// Filters holds the values of every filter[field] parameter, by field.
+	Filters map[string][]string
+}
+
+// SortField is a field to sort by.
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// ParseList parses the list parameters of r's query: page and limit or cursor, sort as a comma separated list
+// of fields prefixed with - for descending order, and filter[field]=value. Fields outside the allowlists of
+// opts, limits above the maximum and malformed values are rejected with a 400.
+func ParseList(r *http.Request, opts ListOptions) (*ListParams, error) {
+	if opts.DefaultLimit == 0 {
+		opts.DefaultLimit = 20
+	}
+	if opts.MaxLimit == 0 {
+		opts.MaxLimit = 100
+	}
+
+	query := r.URL.Query()
+	p := &ListParams{Page: 1, Limit: opts.DefaultLimit, Cursor: query.Get("cursor"), Filters: map[string][]string{}}
+
+	if v := query.Get("page"); v != "" {
+		if p.Cursor != "" {
+			return nil, listInvalid("page and cursor cannot be combined")
+		}
+		page, err := strconv.Atoi(v)
+		if err != nil || page < 1 {
+			return nil, listInvalid("page: %q is not a positive integer", v)
+		}
+		p.Page = page
+	}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return nil, listInvalid("limit: %q is not a positive integer", v)
+		}
+		if limit > opts.MaxLimit {
+			return nil, listInvalid("limit: %d exceeds the maximum of %d", limit, opts.MaxLimit)
+		}
+		p.Limit = limit
+	}
+	if p.Page-1 > math.MaxInt/p.Limit {
+		return nil, listInvalid("page: %d is out of range", p.Page)
+	}
+	p.Offset = (p.Page - 1) * p.Limit
+
+	sort, requested := query.Get("sort"), true
+	if sort == "" {
+		sort, requested = opts.DefaultSort, false
+	}
+	for _, field := range strings.Split(sort, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+
+		sf := SortField{Field: strings.TrimPrefix(field, "-"), Desc: strings.HasPrefix(field, "-")}
+		if requested && !contains(opts.Sortable, sf.Field) {
+			return nil, listInvalid("sort: field %q is not sortable", sf.Field)
+		}
+		p.Sort = append(p.Sort, sf)
+	}
+
+	for key, values := range query {
+		field, ok := strings.CutPrefix(key, "filter[")
+		if !ok {
+			continue
+		}
+		if field, ok = strings.CutSuffix(field, "]"); !ok || !contains(opts.Filterable, field) {
+			return nil, listInvalid("%s: field is not filterable", key)
+		}
+		p.Filters[field] = values
+	}
+
+	return p, nil
+}
+
+// Filter returns the first value of the filter on field, or "" when there is none.
+func (p *ListParams) Filter(field string) string {
+	if values := p.Filters[field]; len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+// Response wraps a page of items in a PaginatedResponse. total is the number of items across all pages, or
+// negative when it is not known; nextCursor is empty on the last page.
+func (p *ListParams) Response(items interface{}, total int64, nextCursor string) PaginatedResponse {
+	resp := PaginatedResponse{Items: items, NextCursor: nextCursor, Limit: p.Limit}
+	if total >= 0 {
+		resp.Total = &total
+	}
+	if p.Cursor == "" {
+		resp.Page = p.Page
+	}
+
+	return resp
+}
+
+// PaginatedResponse is the envelope list endpoints return a page of items in.
+type PaginatedResponse struct {
+	Items      interface{} `json:"items"`
+	Total      *int64      `json:"total,omitempty"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	Page       int         `json:"page,omitempty"`
+	Limit      int         `json:"limit"`
+}
+
+// MarshalJSON encodes nil item slices as [] so clients always receive a list.
+func (r PaginatedResponse) MarshalJSON() ([]byte, error) {
+	if v := reflect.ValueOf(r.Items); !v.IsValid() || v.Kind() == reflect.Slice && v.IsNil() {
+		r.Items = []interface{}{}
+	}
+
+	type envelope PaginatedResponse
+	return json.Marshal(envelope(r))
+}
+
+func listInvalid(format string, args ...interface{}) error {
+	return errors.E(errors.Invalid, errors.CodeBadRequest, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,184 @@
+package gomux
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hunterdishner/errors"
+)
+
+// Translator translates messages, e.g. error messages, into a locale.
+type Translator interface {
+	// Translate returns message in locale, reporting false when it has no translation.
+	Translate(locale, message string) (string, bool)
+}
+
+// Catalog is a Translator holding the translations of each locale by message, e.g.
+// Catalog{"de": {"missing or invalid CSRF token": "fehlendes oder ungültiges CSRF-Token"}}.
+type Catalog map[string]map[string]string
+
+func (c Catalog) Translate(locale, message string) (string, bool) {
+	t, ok := c[locale][message]
+	return t, ok
+}
+
+// LocaleOptions configures locale negotiation.
+type LocaleOptions struct {
+	// Supported lists the locales the service speaks, e.g. "en", "de" and "pt-BR". The first is the default.
+	Supported []string
+	// Translator translates the messages of error responses into the request's locale. Untranslated messages
+	// are sent as they are.
+	Translator Translator
+}
+
+type localeKey struct{}
+
+type requestLocale struct {
+	locale     string
+	translator Translator
+}
+
+// Locales negotiates the locale of every request from its Accept-Language header among opts.Supported, falling
+// back to the first, and puts it in the request context for Locale and Translate. Responses carry the locale in
+// Content-Language, and the messages of error responses, including the field errors of a ValidationError, are
+// translated with opts.Translator.
+func Locales(opts LocaleOptions) Option {
+	return func(s *Server) {
+		s.middleware = append(s.middleware, func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				locale := negotiateLocale(r.Header.Get("Accept-Language"), opts.Supported)
+				if locale != "" {
+					w.Header().Set("Content-Language", locale)
+				}
+				w.Header().Add("Vary", "Accept-Language")
+
+				ctx := context.WithValue(r.Context(), localeKey{}, requestLocale{locale: locale, translator: opts.Translator})
+				next.ServeHTTP(w, r.WithContext(ctx))
+			})
+		})
+	}
+}
+
+// Locale returns the negotiated locale of the request, or "" when Locales is not enabled.
+func Locale(r *http.Request) string {
+	rl, _ := r.Context().Value(localeKey{}).(requestLocale)
+	return rl.locale
+}
+
+// Translate translates message into the request's locale and formats it with args, for messages handlers build
+// themselves, e.g. gomux.Translate(r, "%d items in your cart", n).
+func Translate(r *http.Request, message string, args ...interface{}) string {
+	message = translate(r, message)
+	if len(args) == 0 {
+		return message
+	}
+
+	return fmt.Sprintf(message, args...)
+}
+
+func translate(r *http.Request, message string) string {
+	rl, _ := r.Context().Value(localeKey{}).(requestLocale)
+	if rl.translator == nil {
+		return message
+	}
+
+	if t, ok := rl.translator.Translate(rl.locale, message); ok {
+		return t
+	}
+
+	return message
+}
+
+// negotiateLocale picks the supported locale the client prefers most. A tag matches a supported locale
+// exactly, or by its language when no region matches, e.g. de-AT falls back to de.
+func negotiateLocale(header string, supported []string) string {
+	if len(supported) == 0 {
+		return ""
+	}
+
+	type pref struct {
+		tag string
+		q   float64
+	}
+	var prefs []pref
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			prefs = append(prefs, pref{tag, q})
+		}
+	}
+	sort.SliceStable(prefs, func(i, j int) bool { return prefs[i].q > prefs[j].q })
+
+	for _, p := range prefs {
+		if p.tag == "*" {
+			return supported[0]
+		}
+		for _, l := range supported {
+			if strings.EqualFold(l, p.tag) {
+				return l
+			}
+		}
+		lang, _, _ := strings.Cut(p.tag, "-")
+		for _, l := range supported {
+			if base, _, _ := strings.Cut(l, "-"); strings.EqualFold(base, lang) {
+				return l
+			}
+		}
+	}
+
+	return supported[0]
+}
+
+// translateError returns a copy of e with its message translated into the request's locale, keeping its code,
+// op, kind and stack. The catalog is looked up by the innermost message, without the op and kind text of the
+// errors wrapping it.
+func translateError(r *http.Request, e *errors.Error) *errors.Error {
+	var inner error = e
+	for {
+		ie, ok := inner.(*errors.Error)
+		if !ok || ie.Err == nil {
+			break
+		}
+		inner = ie.Err
+	}
+
+	msg := inner.Error()
+	t := translate(r, msg)
+	if t == msg {
+		return e
+	}
+
+	te := *e
+	te.Err = stderrors.New(t)
+	return &te
+}
+
+// translateFields returns a copy of err with the messages of its fields translated into the request's locale.
+func translateFields(r *http.Request, err *ValidationError) *ValidationError {
+	if _, ok := r.Context().Value(localeKey{}).(requestLocale); !ok {
+		return err
+	}
+
+	fields := make([]FieldError, len(err.Fields))
+	for i, f := range err.Fields {
+		f.Message = translate(r, f.Message)
+		fields[i] = f
+	}
+	return &ValidationError{Fields: fields}
+}
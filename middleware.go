@@ -0,0 +1,23 @@
+package gomux
+
+import "net/http"
+
+// Middleware wraps an http.Handler, e.g. to add logging or authentication around every route.
+type Middleware func(http.Handler) http.Handler
+
+// Use appends middleware to the server's chain. Middleware runs in the order given, inside the CORS handling
+// so preflight requests are answered before it.
+func Use(mw ...Middleware) Option {
+	return func(s *Server) {
+		s.middleware = append(s.middleware, mw...)
+	}
+}
+
+// chain wraps h so that mw[0] is the outermost handler.
+func chain(h http.Handler, mw ...Middleware) http.Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+
+	return h
+}
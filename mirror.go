@@ -0,0 +1,140 @@
+package gomux
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hunterdishner/errors"
+)
+
+const (
+	// mirrorMaxBody is the largest body a mirrored request carries; larger requests are not mirrored.
+	mirrorMaxBody = 1 << 20
+	// mirrorConcurrency bounds the mirrored requests in flight; requests beyond it are not mirrored.
+	mirrorConcurrency = 64
+	mirrorTimeout     = 10 * time.Second
+)
+
+// Mirror copies samplePercent percent of the requests the server handles, bodies included, to target, e.g.
+// gomux.Mirror("http://orders-v2.internal:8080", 5) sends one request in twenty to a new version of the service
+// as well, so it can be validated against production traffic. The copies keep the method, path, query and
+// headers and carry X-Mirrored: true; they are sent in the background and their responses and failures are
+// discarded, so the target can never affect the client. Requests with bodies over 1MB are not mirrored, nor
+// requests beyond 64 copies already in flight.
+func Mirror(target string, samplePercent float64) Option {
+	return func(s *Server) {
+		u, err := url.Parse(target)
+		if err == nil && (u.Scheme == "" || u.Host == "") {
+			err = fmt.Errorf("mirror target %s needs a scheme and host", target)
+		}
+		if err != nil {
+			log.Printf("%+v", errors.E(errors.Invalid, errors.CodeServerError, err))
+			return
+		}
+
+		m := &mirror{
+			target: u,
+			sample: samplePercent / 100,
+			slots:  make(chan struct{}, mirrorConcurrency),
+			client: &http.Client{
+				Timeout: mirrorTimeout,
+				CheckRedirect: func(*http.Request, []*http.Request) error {
+					return http.ErrUseLastResponse
+				},
+			},
+		}
+		s.middleware = append(s.middleware, m.handler)
+	}
+}
+
+type mirror struct {
+	target *url.URL
+	sample float64
+	slots  chan struct{}
+	client *http.Client
+}
+
+func (m *mirror) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.sample <= 0 || rand.Float64() >= m.sample || strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		select {
+		case m.slots <- struct{}{}:
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var body []byte
+		if r.Body != nil && r.Body != http.NoBody {
+			// Read ahead no further than the limit, then hand the handler what was read followed by the rest.
+			var err error
+			body, err = io.ReadAll(io.LimitReader(r.Body, mirrorMaxBody+1))
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+
+			if len(body) > mirrorMaxBody || err != nil {
+				<-m.slots
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		req, err := m.request(r, body)
+		if err != nil {
+			<-m.slots
+			log.Printf("%+v", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		go m.send(req)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// request builds the copy of r sent to the target.
+func (m *mirror) request(r *http.Request, body []byte) (*http.Request, error) {
+	u := *m.target
+	u.Path = strings.TrimSuffix(m.target.Path, "/") + r.URL.Path
+	u.RawPath = ""
+	u.RawQuery = r.URL.RawQuery
+
+	req, err := http.NewRequestWithContext(context.Background(), r.Method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.E(errors.Invalid, errors.CodeServerError, err)
+	}
+
+	req.Header = r.Header.Clone()
+	for _, h := range []string{"Connection", "Keep-Alive", "Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade"} {
+		req.Header.Del(h)
+	}
+	req.Header.Set("X-Mirrored", "true")
+	req.ContentLength = int64(len(body))
+
+	return req, nil
+}
+
+func (m *mirror) send(req *http.Request) {
+	defer func() { <-m.slots }()
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
@@ -0,0 +1,75 @@
+package gomux
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+)
+
+// MTLS requires clients to present a certificate signed by one of clientCAs, rejecting the TLS handshake of
+// those that do not. The identity of the verified certificate is available to handlers through
+// ClientIdentity.
+func MTLS(clientCAs *x509.CertPool) Option {
+	return func(s *Server) {
+		s.clientCAs = clientCAs
+		s.tls = true
+	}
+}
+
+// PeerIdentity is the identity carried by a verified client certificate.
+type PeerIdentity struct {
+	CommonName     string
+	DNSNames       []string
+	EmailAddresses []string
+	// URIs holds the URI SANs, e.g. SPIFFE IDs.
+	URIs        []string
+	Certificate *x509.Certificate
+}
+
+type identityKey struct{}
+
+// ClientIdentity returns the identity of the client certificate verified for the request, reporting false
+// when MTLS is not enabled.
+func ClientIdentity(ctx context.Context) (PeerIdentity, bool) {
+	id, ok := ctx.Value(identityKey{}).(PeerIdentity)
+	return id, ok
+}
+
+// withClientAuth returns a copy of conf requiring client certificates when MTLS is set.
+func (s *Server) withClientAuth(conf *tls.Config) *tls.Config {
+	if s.clientCAs == nil {
+		return conf
+	}
+
+	cfg := &tls.Config{}
+	if conf != nil {
+		cfg = conf.Clone()
+	}
+	cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	cfg.ClientCAs = s.clientCAs
+
+	return cfg
+}
+
+// clientIdentity puts the identity of the verified client certificate in the request context.
+func clientIdentity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+			cert := r.TLS.VerifiedChains[0][0]
+			id := PeerIdentity{
+				CommonName:     cert.Subject.CommonName,
+				DNSNames:       cert.DNSNames,
+				EmailAddresses: cert.EmailAddresses,
+				Certificate:    cert,
+			}
+			for _, u := range cert.URIs {
+				id.URIs = append(id.URIs, u.String())
+			}
+
+			r = r.WithContext(context.WithValue(r.Context(), identityKey{}, id))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,391 @@
+package odata
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expr is a node in a parsed $filter expression.
+type Expr interface {
+	expr()
+}
+
+// Binary is a logical (and, or) or comparison (eq, ne, gt, ge, lt, le) expression.
+type Binary struct {
+	Op    string
+	Left  Expr
+	Right Expr
+}
+
+// Not negates a boolean expression.
+type Not struct {
+	Expr Expr
+}
+
+// Field references a property of the resource.
+type Field struct {
+	Name string
+}
+
+// Literal is a string, float64, bool or nil value.
+type Literal struct {
+	Value interface{}
+}
+
+// Call is one of the supported string functions: contains, startswith or endswith.
+type Call struct {
+	Func string
+	Args []Expr
+}
+
+func (Binary) expr()  {}
+func (Not) expr()     {}
+func (Field) expr()   {}
+func (Literal) expr() {}
+func (Call) expr()    {}
+
+var comparisons = map[string]bool{"eq": true, "ne": true, "gt": true, "ge": true, "lt": true, "le": true}
+
+var functions = map[string]int{"contains": 2, "startswith": 2, "endswith": 2}
+
+// maxDepth bounds the nesting of parentheses, not and function calls, so a hostile $filter cannot exhaust the
+// stack.
+const maxDepth = 32
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+type parser struct {
+	tokens  []token
+	pos     int
+	allowed map[string]bool
+	depth   int
+}
+
+func parseFilter(s string, allowed map[string]bool) (Expr, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, allowed: allowed}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, invalid("$filter: unexpected %q at position %d", tok.text, tok.pos)
+	}
+
+	if !isBoolean(expr) {
+		return nil, invalid("$filter: expression is not a condition")
+	}
+
+	return expr, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+
+	return tok
+}
+
+func (p *parser) keyword(word string) bool {
+	tok := p.peek()
+	if tok.kind == tokIdent && tok.text == word {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+// enter descends one level of nesting, failing past maxDepth. Each call is paired with a deferred leave.
+func (p *parser) enter() error {
+	p.depth++
+	if p.depth > maxDepth {
+		return invalid("$filter: expression nested deeper than %d levels", maxDepth)
+	}
+
+	return nil
+}
+
+func (p *parser) leave() {
+	p.depth--
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if left, err = logical("or", left, right); err != nil {
+			return nil, err
+		}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("and") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if left, err = logical("and", left, right); err != nil {
+			return nil, err
+		}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	if p.keyword("not") {
+		if err := p.enter(); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if !isBoolean(expr) {
+			return nil, invalid("$filter: operand of not is not a condition")
+		}
+
+		return Not{Expr: expr}, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (Expr, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.peek()
+	if tok.kind != tokIdent || !comparisons[tok.text] {
+		return left, nil
+	}
+	p.next()
+
+	right, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	if isBoolean(left) || isBoolean(right) {
+		return nil, invalid("$filter: operands of %s must be values", tok.text)
+	}
+
+	return Binary{Op: tok.text, Left: left, Right: right}, nil
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokLParen:
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, invalid("$filter: expected ) at position %d", closing.pos)
+		}
+
+		return expr, nil
+	case tokString:
+		return Literal{Value: tok.text}, nil
+	case tokNumber:
+		n, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, invalid("$filter: invalid number %q", tok.text)
+		}
+
+		return Literal{Value: n}, nil
+	case tokIdent:
+		switch tok.text {
+		case "true":
+			return Literal{Value: true}, nil
+		case "false":
+			return Literal{Value: false}, nil
+		case "null":
+			return Literal{Value: nil}, nil
+		}
+
+		if p.peek().kind == tokLParen {
+			return p.parseCall(tok)
+		}
+
+		if !p.allowed[tok.text] {
+			return nil, invalid("$filter: field %q is not filterable", tok.text)
+		}
+
+		return Field{Name: tok.text}, nil
+	case tokEOF:
+		return nil, invalid("$filter: unexpected end of expression")
+	default:
+		return nil, invalid("$filter: unexpected %q at position %d", tok.text, tok.pos)
+	}
+}
+
+func (p *parser) parseCall(name token) (Expr, error) {
+	arity, ok := functions[name.text]
+	if !ok {
+		return nil, invalid("$filter: unsupported function %q", name.text)
+	}
+	p.next() // (
+
+	call := Call{Func: name.text}
+	for {
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, arg)
+
+		tok := p.next()
+		if tok.kind == tokRParen {
+			break
+		}
+		if tok.kind != tokComma {
+			return nil, invalid("$filter: expected , or ) at position %d", tok.pos)
+		}
+	}
+
+	if len(call.Args) != arity {
+		return nil, invalid("$filter: %s takes %d arguments", call.Func, arity)
+	}
+	for _, arg := range call.Args {
+		if isBoolean(arg) {
+			return nil, invalid("$filter: arguments of %s must be values", call.Func)
+		}
+		if lit, ok := arg.(Literal); ok {
+			if _, ok := lit.Value.(string); !ok {
+				return nil, invalid("$filter: arguments of %s must be fields or strings", call.Func)
+			}
+		}
+	}
+
+	return call, nil
+}
+
+func logical(op string, left, right Expr) (Expr, error) {
+	if !isBoolean(left) || !isBoolean(right) {
+		return nil, invalid("$filter: operands of %s must be conditions", op)
+	}
+
+	return Binary{Op: op, Left: left, Right: right}, nil
+}
+
+// isBoolean reports whether expr produces a condition rather than a value.
+func isBoolean(expr Expr) bool {
+	switch e := expr.(type) {
+	case Binary, Not, Call:
+		return true
+	case Literal:
+		_, ok := e.Value.(bool)
+		return ok
+	default:
+		return false
+	}
+}
+
+func lex(s string) ([]token, error) {
+	var tokens []token
+
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")", i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokComma, ",", i})
+			i++
+		case c == '\'':
+			start := i
+			var b strings.Builder
+			for i++; ; i++ {
+				if i >= len(s) {
+					return nil, invalid("$filter: unterminated string at position %d", start)
+				}
+				if s[i] == '\'' {
+					if i+1 < len(s) && s[i+1] == '\'' {
+						b.WriteByte('\'')
+						i++
+						continue
+					}
+					i++
+					break
+				}
+				b.WriteByte(s[i])
+			}
+			tokens = append(tokens, token{tokString, b.String(), start})
+		case c == '-' || unicode.IsDigit(c):
+			start := i
+			for i++; i < len(s) && (unicode.IsDigit(rune(s[i])) || s[i] == '.'); i++ {
+			}
+			tokens = append(tokens, token{tokNumber, s[start:i], start})
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i++; i < len(s) && (unicode.IsLetter(rune(s[i])) || unicode.IsDigit(rune(s[i])) || s[i] == '_' || s[i] == '/'); i++ {
+			}
+			tokens = append(tokens, token{tokIdent, s[start:i], start})
+		default:
+			return nil, invalid("$filter: unexpected character %q at position %d", c, i)
+		}
+	}
+
+	return append(tokens, token{kind: tokEOF, pos: len(s)}), nil
+}
@@ -0,0 +1,156 @@
+package odata
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hunterdishner/errors"
+)
+
+var testFilterable = allowlist([]string{"name", "age", "active", "address/city"})
+
+func field(name string) Field { return Field{Name: name} }
+
+func lit(v interface{}) Literal { return Literal{Value: v} }
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   Expr
+	}{
+		{"name eq 'Ada'", Binary{"eq", field("name"), lit("Ada")}},
+		{"age ne 30", Binary{"ne", field("age"), lit(30.0)}},
+		{"age gt -1.5", Binary{"gt", field("age"), lit(-1.5)}},
+		{"age ge 18", Binary{"ge", field("age"), lit(18.0)}},
+		{"age lt 65", Binary{"lt", field("age"), lit(65.0)}},
+		{"age le 65", Binary{"le", field("age"), lit(65.0)}},
+		{"name eq null", Binary{"eq", field("name"), lit(nil)}},
+		{"'Ada' eq name", Binary{"eq", lit("Ada"), field("name")}},
+		{"active eq name", Binary{"eq", field("active"), field("name")}},
+		{"address/city eq 'Paris'", Binary{"eq", field("address/city"), lit("Paris")}},
+		{"name eq 'it''s'", Binary{"eq", field("name"), lit("it's")}},
+		{"name eq ''", Binary{"eq", field("name"), lit("")}},
+		{"true", lit(true)},
+		{"false or true", Binary{"or", lit(false), lit(true)}},
+
+		// and binds tighter than or, and both are left associative.
+		{"age eq 1 or age eq 2 and age eq 3",
+			Binary{"or", Binary{"eq", field("age"), lit(1.0)}, Binary{"and", Binary{"eq", field("age"), lit(2.0)}, Binary{"eq", field("age"), lit(3.0)}}}},
+		{"(age eq 1 or age eq 2) and age eq 3",
+			Binary{"and", Binary{"or", Binary{"eq", field("age"), lit(1.0)}, Binary{"eq", field("age"), lit(2.0)}}, Binary{"eq", field("age"), lit(3.0)}}},
+		{"age eq 1 or age eq 2 or age eq 3",
+			Binary{"or", Binary{"or", Binary{"eq", field("age"), lit(1.0)}, Binary{"eq", field("age"), lit(2.0)}}, Binary{"eq", field("age"), lit(3.0)}}},
+		{" ( ( age  eq 1 ) ) ", Binary{"eq", field("age"), lit(1.0)}},
+
+		// not applies to the next condition only.
+		{"not (age lt 18)", Not{Binary{"lt", field("age"), lit(18.0)}}},
+		{"not not true", Not{Not{lit(true)}}},
+		{"not true and false", Binary{"and", Not{lit(true)}, lit(false)}},
+
+		{"contains(name, 'da')", Call{"contains", []Expr{field("name"), lit("da")}}},
+		{"startswith(name,'A') and endswith(address/city, 's')",
+			Binary{"and", Call{"startswith", []Expr{field("name"), lit("A")}}, Call{"endswith", []Expr{field("address/city"), lit("s")}}}},
+		{"not contains(name, 'x')", Not{Call{"contains", []Expr{field("name"), lit("x")}}}},
+	}
+
+	for _, tt := range tests {
+		got, err := parseFilter(tt.filter, testFilterable)
+		if err != nil {
+			t.Errorf("parseFilter(%q): %v", tt.filter, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseFilter(%q) = %#v, want %#v", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	tests := []struct {
+		filter string
+		// want is part of the error message.
+		want string
+	}{
+		{"", "unexpected end"},
+		{"   ", "unexpected end"},
+		{"name eq", "unexpected end"},
+		{"name eq 'Ada", "unterminated string"},
+		{"name eq 'Ada' and", "unexpected end"},
+		{"name", "not a condition"},
+		{"'Ada'", "not a condition"},
+		{"42", "not a condition"},
+		{"secret eq 1", `field "secret" is not filterable`},
+		{"Name eq 'Ada'", `field "Name" is not filterable`},
+		{"name eq 'Ada' and age", "operands of and must be conditions"},
+		{"age or true", "operands of or must be conditions"},
+		{"true eq 1", "operands of eq must be values"},
+		{"age eq 1 eq 2", `unexpected "eq"`},
+		{"contains(name, 'a') eq true", "operands of eq must be values"},
+		{"not name", "operand of not is not a condition"},
+		{"not active eq true", "operands of eq must be values"},
+		{"(name eq 'Ada'", "expected )"},
+		{"name eq 'Ada')", `unexpected ")"`},
+		{")", `unexpected ")"`},
+		{"name eq ,", `unexpected ","`},
+		{"age eq 1.2.3", "invalid number"},
+		{"age eq -", "invalid number"},
+		{"name eq 'Ada' & age eq 1", "unexpected character"},
+		{"name eq \"Ada\"", "unexpected character"},
+		{"substringof('a', name)", `unsupported function "substringof"`},
+		{"contains(name)", "contains takes 2 arguments"},
+		{"contains(name, 'a', 'b')", "contains takes 2 arguments"},
+		{"contains()", "unexpected"},
+		{"contains(name, 'a' 'b')", "expected , or )"},
+		{"contains(name, 'a'", "expected , or )"},
+		{"contains(name, 1)", "must be fields or strings"},
+		{"contains(name, age eq 1)", "arguments of contains must be values"},
+	}
+
+	for _, tt := range tests {
+		_, err := parseFilter(tt.filter, testFilterable)
+		if err == nil {
+			t.Errorf("parseFilter(%q) succeeded, want an error", tt.filter)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseFilter(%q) = %q, want it to mention %q", tt.filter, err, tt.want)
+		}
+		if e, ok := err.(*errors.Error); !ok || e.Code != errors.CodeBadRequest {
+			t.Errorf("parseFilter(%q) = %#v, want a bad request", tt.filter, err)
+		}
+	}
+}
+
+func TestParseFilterDepth(t *testing.T) {
+	// The expression itself is one level, so maxDepth-1 parentheses, nots or rounds of both still parse.
+	nested := func(open, close string, n int, inner string) string {
+		return strings.Repeat(open, n) + inner + strings.Repeat(close, n)
+	}
+
+	tests := []struct {
+		name, filter string
+		ok           bool
+	}{
+		{"parentheses", nested("(", ")", maxDepth-1, "age eq 1"), true},
+		{"too many parentheses", nested("(", ")", maxDepth, "age eq 1"), false},
+		{"nots", nested("not ", "", maxDepth-1, "true"), true},
+		{"too many nots", nested("not ", "", maxDepth, "true"), false},
+		{"mixed", nested("not (", ")", (maxDepth-1)/2, "true"), true},
+		{"too many mixed", nested("not (", ")", maxDepth/2, "true"), false},
+		// Each argument of a call is an expression of its own.
+		{"call arguments", nested("(", ")", maxDepth-2, "contains(name, 'a')"), true},
+		{"too deep call arguments", nested("(", ")", maxDepth-1, "contains(name, 'a')"), false},
+		{"hostile", nested("(", ")", 1000000, "age eq 1"), false},
+	}
+
+	for _, tt := range tests {
+		_, err := parseFilter(tt.filter, testFilterable)
+		if tt.ok && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if !tt.ok && (err == nil || !strings.Contains(err.Error(), "nested deeper than 32 levels")) {
+			t.Errorf("%s: error = %v, want the depth limit", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Package odata parses a pragmatic subset of the OData query options ($filter, $select, $orderby, $top and
+// $skip) into a typed form. Every field referenced by a query must appear in the corresponding allowlist of
+// Options; anything else is rejected with a 400.
+package odata
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/hunterdishner/errors"
+)
+
+// Options controls which fields may be referenced by each query option.
+type Options struct {
+	Filterable []string
+	Selectable []string
+	Sortable   []string
+	// MaxTop caps $top. Zero means no cap.
+	MaxTop int
+}
+
+// Query is the parsed form of the supported query options. Unset options are left at their zero value.
+type Query struct {
+	Filter  Expr
+	Select  []string
+	OrderBy []OrderBy
+	Top     *int
+	Skip    int
+}
+
+// OrderBy is a single $orderby clause.
+type OrderBy struct {
+	Field string
+	Desc  bool
+}
+
+// ParseRequest parses the query options on r's URL.
+func ParseRequest(r *http.Request, opts Options) (*Query, error) {
+	return Parse(r.URL.Query(), opts)
+}
+
+// Parse parses the query options found in values.
+func Parse(values url.Values, opts Options) (*Query, error) {
+	q := &Query{}
+
+	if v := values.Get("$filter"); v != "" {
+		expr, err := parseFilter(v, allowlist(opts.Filterable))
+		if err != nil {
+			return nil, err
+		}
+		q.Filter = expr
+	}
+
+	if v := values.Get("$select"); v != "" {
+		allowed := allowlist(opts.Selectable)
+		for _, f := range strings.Split(v, ",") {
+			f = strings.TrimSpace(f)
+			if !allowed[f] {
+				return nil, invalid("$select: field %q is not selectable", f)
+			}
+			q.Select = append(q.Select, f)
+		}
+	}
+
+	if v := values.Get("$orderby"); v != "" {
+		allowed := allowlist(opts.Sortable)
+		for _, clause := range strings.Split(v, ",") {
+			parts := strings.Fields(clause)
+			if len(parts) == 0 || len(parts) > 2 {
+				return nil, invalid("$orderby: malformed clause %q", clause)
+			}
+
+			ob := OrderBy{Field: parts[0]}
+			if len(parts) == 2 {
+				switch strings.ToLower(parts[1]) {
+				case "asc":
+				case "desc":
+					ob.Desc = true
+				default:
+					return nil, invalid("$orderby: unknown direction %q", parts[1])
+				}
+			}
+
+			if !allowed[ob.Field] {
+				return nil, invalid("$orderby: field %q is not sortable", ob.Field)
+			}
+			q.OrderBy = append(q.OrderBy, ob)
+		}
+	}
+
+	if v := values.Get("$top"); v != "" {
+		top, err := strconv.Atoi(v)
+		if err != nil || top < 0 {
+			return nil, invalid("$top: %q is not a non-negative integer", v)
+		}
+		if opts.MaxTop > 0 && top > opts.MaxTop {
+			return nil, invalid("$top: %d exceeds the maximum of %d", top, opts.MaxTop)
+		}
+		q.Top = &top
+	}
+
+	if v := values.Get("$skip"); v != "" {
+		skip, err := strconv.Atoi(v)
+		if err != nil || skip < 0 {
+			return nil, invalid("$skip: %q is not a non-negative integer", v)
+		}
+		q.Skip = skip
+	}
+
+	return q, nil
+}
+
+func allowlist(fields []string) map[string]bool {
+	m := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		m[f] = true
+	}
+
+	return m
+}
+
+func invalid(format string, args ...interface{}) error {
+	return errors.E(errors.Invalid, errors.CodeBadRequest, fmt.Sprintf(format, args...))
+}
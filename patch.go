@@ -0,0 +1,518 @@
+package gomux
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/hunterdishner/errors"
+)
+
+// ApplyPatch applies the body of a PATCH request to target, a pointer to the resource as its GET route returns
+// it. A JSON Patch (RFC 6902, application/json-patch+json) or a JSON Merge Patch (RFC 7386,
+// application/merge-patch+json) is accepted. target is only changed when the whole patch applies, and fields
+// JSON does not carry, such as json:"-" and unexported ones, keep their values.
+//
+// A request whose If-Match names another version of target is rejected with a 412, like CheckIfMatch. A
+// malformed patch is answered with a 400, other content types with a 415, a patch that does not apply to the
+// current document, such as a failing test operation or a missing path, with a 409, and a result that does not
+// fit target's type with a 422.
+func ApplyPatch(r *http.Request, target interface{}) error {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.E(errors.Invalid, errors.CodeServerError, fmt.Sprintf("gomux: ApplyPatch needs a pointer, got %T", target))
+	}
+
+	if err := CheckIfMatch(r, target); err != nil {
+		return err
+	}
+
+	mediatype, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediatype != "application/json-patch+json" && mediatype != "application/merge-patch+json" {
+		return errors.E(errors.Invalid, errors.Code(http.StatusUnsupportedMediaType), "patch must be application/json-patch+json or application/merge-patch+json")
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		if bodyErr := bodyError(err); bodyErr != nil {
+			return bodyErr
+		}
+		return errors.E(errors.IO, errors.CodeBadRequest, err)
+	}
+
+	current, err := json.Marshal(target)
+	if err != nil {
+		return errors.E(errors.Encoding, errors.CodeServerError, err)
+	}
+	doc, err := decodeJSON(current)
+	if err != nil {
+		return errors.E(errors.Encoding, errors.CodeServerError, err)
+	}
+
+	if mediatype == "application/merge-patch+json" {
+		patch, err := decodeJSON(body)
+		if err != nil {
+			return errors.E(errors.Encoding, errors.CodeBadRequest, err)
+		}
+		doc = mergePatch(doc, patch)
+	} else {
+		var ops []patchOp
+		if err := json.Unmarshal(body, &ops); err != nil {
+			return errors.E(errors.Encoding, errors.CodeBadRequest, err)
+		}
+		for i, op := range ops {
+			if doc, err = op.apply(doc); err != nil {
+				return patchError(i, op, err)
+			}
+		}
+	}
+
+	patched, err := json.Marshal(doc)
+	if err != nil {
+		return errors.E(errors.Encoding, errors.CodeServerError, err)
+	}
+
+	// Decoding into a copy of target keeps what JSON does not carry, e.g. json:"-" and unexported fields, so
+	// what the patch removed has to be cleared explicitly.
+	before, err := decodeJSON(current)
+	if err != nil {
+		return errors.E(errors.Encoding, errors.CodeServerError, err)
+	}
+	result := reflect.New(rv.Elem().Type())
+	result.Elem().Set(rv.Elem())
+	clearPatched(result.Elem(), before, doc)
+
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(result.Interface()); err != nil {
+		return errors.E(errors.Invalid, errors.Code(http.StatusUnprocessableEntity), "patched resource is invalid: "+err.Error())
+	}
+	rv.Elem().Set(result.Elem())
+
+	return nil
+}
+
+// clearPatched zeroes the fields of v whose members the patch removed, going from before to after, so decoding
+// after into v leaves nothing behind. Maps and slices are zeroed whole, since decoding merges into maps and
+// into the elements of slices, which a patch may have reordered. Pointers are copied on the way, since the
+// copy of target still shares them and decoding writes through them.
+func clearPatched(v reflect.Value, before, after interface{}) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		cp := reflect.New(v.Type().Elem())
+		cp.Elem().Set(v.Elem())
+		v.Set(cp)
+		v = cp.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice:
+		v.Set(reflect.Zero(v.Type()))
+		return
+	case reflect.Struct:
+	default:
+		return
+	}
+
+	b, ok := before.(map[string]interface{})
+	if !ok {
+		return
+	}
+	a, _ := after.(map[string]interface{})
+
+	eachJSONField(v, func(name string, field reflect.Value) {
+		if _, ok := b[name]; !ok {
+			return
+		}
+		if _, ok := a[name]; !ok {
+			field.Set(reflect.Zero(field.Type()))
+			return
+		}
+		clearPatched(field, b[name], a[name])
+	})
+}
+
+// eachJSONField calls fn with the settable exported fields of the struct v under their JSON names, promoting
+// the fields of embedded structs as encoding/json does.
+func eachJSONField(v reflect.Value, fn func(name string, field reflect.Value)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		field := v.Field(i)
+		if sf.Anonymous && name == "" {
+			for field.Kind() == reflect.Ptr {
+				if field.IsNil() {
+					break
+				}
+				field = field.Elem()
+			}
+			if field.Kind() == reflect.Struct {
+				eachJSONField(field, fn)
+				continue
+			}
+		}
+		if sf.PkgPath != "" || !field.CanSet() {
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+		fn(name, field)
+	}
+}
+
+func decodeJSON(b []byte) (interface{}, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// mergePatch applies an RFC 7386 merge patch to target.
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+
+	return t
+}
+
+// patchOp is an RFC 6902 operation.
+type patchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// errPatchInvalid marks errors of malformed operations, as opposed to ones that do not apply to the document.
+type errPatchInvalid struct{ msg string }
+
+func (e errPatchInvalid) Error() string { return e.msg }
+
+func patchError(i int, op patchOp, err error) error {
+	msg := fmt.Sprintf("patch operation %d (%s %s): %v", i, op.Op, op.Path, err)
+	if _, ok := err.(errPatchInvalid); ok {
+		return errors.E(errors.Invalid, errors.CodeBadRequest, msg)
+	}
+
+	return errors.E(errors.Invalid, errors.Code(http.StatusConflict), msg)
+}
+
+func (op patchOp) apply(doc interface{}) (interface{}, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	value := func() (interface{}, error) {
+		if op.Value == nil {
+			return nil, errPatchInvalid{"missing value"}
+		}
+		v, err := decodeJSON(op.Value)
+		if err != nil {
+			return nil, errPatchInvalid{err.Error()}
+		}
+		return v, nil
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		switch op.Op {
+		case "add":
+			return pointerAdd(doc, path, v)
+		case "replace":
+			return pointerReplace(doc, path, v)
+		}
+		current, err := pointerGet(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !jsonEqual(current, v) {
+			return nil, fmt.Errorf("test failed")
+		}
+		return doc, nil
+	case "remove":
+		doc, _, err := pointerRemove(doc, path)
+		return doc, err
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			if isPrefix(from, path) && len(from) < len(path) {
+				return nil, errPatchInvalid{"cannot move a value into itself"}
+			}
+			doc, v, err := pointerRemove(doc, from)
+			if err != nil {
+				return nil, err
+			}
+			return pointerAdd(doc, path, v)
+		}
+		v, err := pointerGet(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, deepCopyJSON(v))
+	}
+
+	return nil, errPatchInvalid{fmt.Sprintf("unknown op %q", op.Op)}
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into its unescaped reference tokens.
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(p, "/") {
+		return nil, errPatchInvalid{fmt.Sprintf("invalid pointer %q", p)}
+	}
+
+	tokens := strings.Split(p[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+
+	return tokens, nil
+}
+
+func isPrefix(prefix, tokens []string) bool {
+	if len(prefix) > len(tokens) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != tokens[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func pointerGet(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch c := doc.(type) {
+		case map[string]interface{}:
+			v, ok := c[token]
+			if !ok {
+				return nil, fmt.Errorf("%q does not exist", token)
+			}
+			doc = v
+		case []interface{}:
+			i, err := arrayIndex(token, len(c)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = c[i]
+		default:
+			return nil, fmt.Errorf("%q does not exist", token)
+		}
+	}
+
+	return doc, nil
+}
+
+// pointerUpdate replaces the container holding the last token of path with what fn makes of it.
+func pointerUpdate(doc interface{}, path []string, fn func(container interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+
+	child, err := pointerGet(doc, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	child, err = pointerUpdate(child, path[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c := doc.(type) {
+	case map[string]interface{}:
+		c[path[0]] = child
+	case []interface{}:
+		i, _ := arrayIndex(path[0], len(c)-1)
+		c[i] = child
+	}
+
+	return doc, nil
+}
+
+func pointerAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return pointerUpdate(doc, path, func(container interface{}, token string) (interface{}, error) {
+		switch c := container.(type) {
+		case map[string]interface{}:
+			c[token] = value
+			return c, nil
+		case []interface{}:
+			i := len(c)
+			if token != "-" {
+				var err error
+				if i, err = arrayIndex(token, len(c)); err != nil {
+					return nil, err
+				}
+			}
+			c = append(c, nil)
+			copy(c[i+1:], c[i:])
+			c[i] = value
+			return c, nil
+		}
+		return nil, fmt.Errorf("parent of %q is not an object or array", token)
+	})
+}
+
+func pointerReplace(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if _, err := pointerGet(doc, path); err != nil {
+		return nil, err
+	}
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return pointerUpdate(doc, path, func(container interface{}, token string) (interface{}, error) {
+		switch c := container.(type) {
+		case map[string]interface{}:
+			c[token] = value
+		case []interface{}:
+			i, _ := arrayIndex(token, len(c)-1)
+			c[i] = value
+		}
+		return container, nil
+	})
+}
+
+func pointerRemove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, errPatchInvalid{"cannot remove the whole document"}
+	}
+
+	removed, err := pointerGet(doc, path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	doc, err = pointerUpdate(doc, path, func(container interface{}, token string) (interface{}, error) {
+		switch c := container.(type) {
+		case map[string]interface{}:
+			delete(c, token)
+			return c, nil
+		case []interface{}:
+			i, _ := arrayIndex(token, len(c)-1)
+			return append(c[:i], c[i+1:]...), nil
+		}
+		return container, nil
+	})
+
+	return doc, removed, err
+}
+
+// arrayIndex parses an array index token, which must be at most max.
+func arrayIndex(token string, max int) (int, error) {
+	if token == "" || len(token) > 1 && token[0] == '0' || strings.Trim(token, "0123456789") != "" {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i > max {
+		return 0, fmt.Errorf("array index %s out of range", token)
+	}
+
+	return i, nil
+}
+
+// jsonEqual compares decoded JSON values, treating numbers as equal when their values are.
+func jsonEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		fa, errA := a.Float64()
+		fb, errB := b.Float64()
+		return errA == nil && errB == nil && fa == fb
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			if w, ok := b[k]; !ok || !jsonEqual(v, w) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !jsonEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return a == b
+}
+
+func deepCopyJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			c[k] = deepCopyJSON(e)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, e := range v {
+			c[i] = deepCopyJSON(e)
+		}
+		return c
+	}
+
+	return v
+}
@@ -0,0 +1,228 @@
+package gomux
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hunterdishner/errors"
+)
+
+func patchRequest(contentType, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+	return r
+}
+
+func mustDecode(t *testing.T, s string) interface{} {
+	t.Helper()
+
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("decoding %s: %v", s, err)
+	}
+	return v
+}
+
+// errorCode returns the code of an error ApplyPatch returned, or 0 for nil.
+func errorCode(t *testing.T, err error) errors.Code {
+	t.Helper()
+
+	if err == nil {
+		return 0
+	}
+	e, ok := err.(*errors.Error)
+	if !ok {
+		t.Fatalf("error %v is a %T, not an *errors.Error", err, err)
+	}
+	return e.Code
+}
+
+// The examples of RFC 6902 appendix A. A.13, an operation with two op members, is left out: encoding/json keeps
+// the last of duplicate members rather than rejecting them.
+func TestApplyJSONPatch(t *testing.T) {
+	tests := []struct {
+		name, doc, patch, want string
+		// code is the status of a patch that does not apply, with doc left as it was.
+		code int
+	}{
+		{name: "A.1 adding an object member",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": "qux"}]`,
+			want:  `{"baz": "qux", "foo": "bar"}`},
+		{name: "A.2 adding an array element",
+			doc:   `{"foo": ["bar", "baz"]}`,
+			patch: `[{"op": "add", "path": "/foo/1", "value": "qux"}]`,
+			want:  `{"foo": ["bar", "qux", "baz"]}`},
+		{name: "A.3 removing an object member",
+			doc:   `{"baz": "qux", "foo": "bar"}`,
+			patch: `[{"op": "remove", "path": "/baz"}]`,
+			want:  `{"foo": "bar"}`},
+		{name: "A.4 removing an array element",
+			doc:   `{"foo": ["bar", "qux", "baz"]}`,
+			patch: `[{"op": "remove", "path": "/foo/1"}]`,
+			want:  `{"foo": ["bar", "baz"]}`},
+		{name: "A.5 replacing a value",
+			doc:   `{"baz": "qux", "foo": "bar"}`,
+			patch: `[{"op": "replace", "path": "/baz", "value": "boo"}]`,
+			want:  `{"baz": "boo", "foo": "bar"}`},
+		{name: "A.6 moving a value",
+			doc:   `{"foo": {"bar": "baz", "waldo": "fred"}, "qux": {"corge": "grault"}}`,
+			patch: `[{"op": "move", "from": "/foo/waldo", "path": "/qux/thud"}]`,
+			want:  `{"foo": {"bar": "baz"}, "qux": {"corge": "grault", "thud": "fred"}}`},
+		{name: "A.7 moving an array element",
+			doc:   `{"foo": ["all", "grass", "cows", "eat"]}`,
+			patch: `[{"op": "move", "from": "/foo/1", "path": "/foo/3"}]`,
+			want:  `{"foo": ["all", "cows", "eat", "grass"]}`},
+		{name: "A.8 testing a value: success",
+			doc:   `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+			patch: `[{"op": "test", "path": "/baz", "value": "qux"}, {"op": "test", "path": "/foo/1", "value": 2}]`,
+			want:  `{"baz": "qux", "foo": ["a", 2, "c"]}`},
+		{name: "A.9 testing a value: error",
+			doc:   `{"baz": "qux"}`,
+			patch: `[{"op": "test", "path": "/baz", "value": "bar"}]`,
+			code:  http.StatusConflict},
+		{name: "A.10 adding a nested member object",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/child", "value": {"grandchild": {}}}]`,
+			want:  `{"foo": "bar", "child": {"grandchild": {}}}`},
+		{name: "A.11 ignoring unrecognized elements",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": "qux", "xyz": 123}]`,
+			want:  `{"foo": "bar", "baz": "qux"}`},
+		{name: "A.12 adding to a nonexistent target",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz/bat", "value": "qux"}]`,
+			code:  http.StatusConflict},
+		{name: "A.14 ~ escape ordering",
+			doc:   `{"/": 9, "~1": 10}`,
+			patch: `[{"op": "test", "path": "/~01", "value": 10}]`,
+			want:  `{"/": 9, "~1": 10}`},
+		{name: "A.15 comparing strings and numbers",
+			doc:   `{"/": 9, "~1": 10}`,
+			patch: `[{"op": "test", "path": "/~01", "value": "10"}]`,
+			code:  http.StatusConflict},
+		{name: "A.16 adding an array value",
+			doc:   `{"foo": ["bar"]}`,
+			patch: `[{"op": "add", "path": "/foo/-", "value": ["abc", "def"]}]`,
+			want:  `{"foo": ["bar", ["abc", "def"]]}`},
+
+		// A patch applies whole or not at all.
+		{name: "a failing operation after one that applied",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": "qux"}, {"op": "test", "path": "/foo", "value": "baz"}]`,
+			code:  http.StatusConflict},
+		{name: "removing a missing member",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "remove", "path": "/baz"}]`,
+			code:  http.StatusConflict},
+		{name: "an index past the end",
+			doc:   `{"foo": ["bar"]}`,
+			patch: `[{"op": "add", "path": "/foo/2", "value": "qux"}]`,
+			code:  http.StatusConflict},
+		{name: "an unknown op",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "frob", "path": "/foo"}]`,
+			code:  http.StatusBadRequest},
+		{name: "a missing value",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz"}]`,
+			code:  http.StatusBadRequest},
+		{name: "a pointer without a leading slash",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "remove", "path": "foo"}]`,
+			code:  http.StatusBadRequest},
+		{name: "moving a value into itself",
+			doc:   `{"foo": {"bar": 1}}`,
+			patch: `[{"op": "move", "from": "/foo", "path": "/foo/bar/baz"}]`,
+			code:  http.StatusBadRequest},
+		{name: "a patch that is not an array",
+			doc:   `{"foo": "bar"}`,
+			patch: `{"op": "remove", "path": "/foo"}`,
+			code:  http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := mustDecode(t, tt.doc)
+			err := ApplyPatch(patchRequest("application/json-patch+json", tt.patch), &doc)
+			if code := errorCode(t, err); code != errors.Code(tt.code) {
+				t.Fatalf("ApplyPatch = %v, want code %d", err, tt.code)
+			}
+
+			want := tt.want
+			if tt.code != 0 {
+				want = tt.doc
+			}
+			if w := mustDecode(t, want); !reflect.DeepEqual(doc, w) {
+				t.Errorf("document = %#v, want %#v", doc, w)
+			}
+		})
+	}
+}
+
+// The examples of RFC 7386 appendix A.
+func TestApplyMergePatch(t *testing.T) {
+	tests := []struct{ doc, patch, want string }{
+		{`{"a": "b"}`, `{"a": "c"}`, `{"a": "c"}`},
+		{`{"a": "b"}`, `{"b": "c"}`, `{"a": "b", "b": "c"}`},
+		{`{"a": "b"}`, `{"a": null}`, `{}`},
+		{`{"a": "b", "b": "c"}`, `{"a": null}`, `{"b": "c"}`},
+		{`{"a": ["b"]}`, `{"a": "c"}`, `{"a": "c"}`},
+		{`{"a": "c"}`, `{"a": ["b"]}`, `{"a": ["b"]}`},
+		{`{"a": {"b": "c"}}`, `{"a": {"b": "d", "c": null}}`, `{"a": {"b": "d"}}`},
+		{`{"a": [{"b": "c"}]}`, `{"a": [1]}`, `{"a": [1]}`},
+		{`["a", "b"]`, `["c", "d"]`, `["c", "d"]`},
+		{`{"a": "b"}`, `["c"]`, `["c"]`},
+		{`{"a": "foo"}`, `null`, `null`},
+		{`{"a": "foo"}`, `"bar"`, `"bar"`},
+		{`{"e": null}`, `{"a": 1}`, `{"e": null, "a": 1}`},
+		{`[1, 2]`, `{"a": "b", "c": null}`, `{"a": "b"}`},
+		{`{}`, `{"a": {"bb": {"ccc": null}}}`, `{"a": {"bb": {}}}`},
+	}
+
+	for _, tt := range tests {
+		doc := mustDecode(t, tt.doc)
+		if err := ApplyPatch(patchRequest("application/merge-patch+json", tt.patch), &doc); err != nil {
+			t.Errorf("%s merged with %s: %v", tt.doc, tt.patch, err)
+			continue
+		}
+		if want := mustDecode(t, tt.want); !reflect.DeepEqual(doc, want) {
+			t.Errorf("%s merged with %s = %#v, want %#v", tt.doc, tt.patch, doc, want)
+		}
+	}
+}
+
+func TestApplyPatchStruct(t *testing.T) {
+	type resource struct {
+		Name   string            `json:"name"`
+		Tags   map[string]string `json:"tags,omitempty"`
+		Secret string            `json:"-"`
+	}
+
+	res := resource{Name: "a", Tags: map[string]string{"x": "1", "y": "2"}, Secret: "s"}
+	r := patchRequest("application/merge-patch+json", `{"name": "b", "tags": {"x": null}}`)
+	if err := ApplyPatch(r, &res); err != nil {
+		t.Fatal(err)
+	}
+	if want := (resource{Name: "b", Tags: map[string]string{"y": "2"}, Secret: "s"}); !reflect.DeepEqual(res, want) {
+		t.Errorf("resource = %+v, want %+v", res, want)
+	}
+
+	// A field the type does not have is a 422, leaving the resource as it was.
+	r = patchRequest("application/json-patch+json", `[{"op": "add", "path": "/age", "value": 3}]`)
+	if code := errorCode(t, ApplyPatch(r, &res)); code != errors.Code(http.StatusUnprocessableEntity) {
+		t.Errorf("code = %d, want %d", code, http.StatusUnprocessableEntity)
+	}
+	if res.Name != "b" {
+		t.Errorf("resource = %+v after a failed patch", res)
+	}
+
+	r = patchRequest("application/json", `{"name": "c"}`)
+	if code := errorCode(t, ApplyPatch(r, &res)); code != errors.Code(http.StatusUnsupportedMediaType) {
+		t.Errorf("code = %d, want %d", code, http.StatusUnsupportedMediaType)
+	}
+}
@@ -0,0 +1,89 @@
+package gomux
+
+import (
+	"crypto/subtle"
+	"expvar"
+	"log"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/hunterdishner/errors"
+)
+
+// EnableProfiling mounts the net/http/pprof handlers under /debug/pprof/ and expvar under /debug/vars. They are
+// served on the admin listener when AdminPort is set, otherwise under the server's prefix on the API port.
+func EnableProfiling() Option {
+	return func(s *Server) {
+		s.profiling = true
+	}
+}
+
+// ProfilingAuth guards the profiling endpoints with HTTP basic auth.
+func ProfilingAuth(user, password string) Option {
+	return func(s *Server) {
+		s.profilingUser, s.profilingPassword = user, password
+	}
+}
+
+// ProfilingAuthSecret is ProfilingAuth with the password resolved from the Secrets provider under name on each
+// request, so it can be rotated while the server runs.
+func ProfilingAuthSecret(user, name string) Option {
+	return func(s *Server) {
+		s.profilingUser, s.profilingSecret = user, name
+	}
+}
+
+// mountProfiling registers the profiling endpoints once every option has been applied.
+func (s *Server) mountProfiling() {
+	if !s.profiling {
+		return
+	}
+
+	debug := http.NewServeMux()
+	debug.HandleFunc("/debug/pprof/", pprof.Index)
+	debug.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	debug.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	debug.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	debug.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	debug.Handle("/debug/vars", expvar.Handler())
+
+	var h http.Handler = debug
+	var auth string
+	switch {
+	case s.profilingSecret != "":
+		h, auth = basicAuth(s.profilingUser, func(r *http.Request) ([]byte, error) { return s.Secret(r.Context(), s.profilingSecret) }, h), "basic"
+	case s.profilingUser != "" || s.profilingPassword != "":
+		h, auth = basicAuth(s.profilingUser, func(*http.Request) ([]byte, error) { return []byte(s.profilingPassword), nil }, h), "basic"
+	}
+
+	if s.admin != nil {
+		s.admin.Handle("/debug/", h)
+		s.unrouted = append(s.unrouted, RouteAuth{Method: http.MethodGet, Path: "/debug/", Auth: auth, Admin: true})
+		return
+	}
+
+	s.mux.PathPrefix("/debug/").Handler(http.StripPrefix("/"+s.name, h))
+	s.unrouted = append(s.unrouted, RouteAuth{Method: http.MethodGet, Path: "/" + s.name + "/debug/", Auth: auth})
+}
+
+func basicAuth(user string, password func(*http.Request) ([]byte, error), next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		want, err := password(r)
+		if err != nil {
+			log.Printf("%+v", errors.E(errors.IO, errors.CodeServerError, err))
+			w.Header().Set("Content-Type", "application/json")
+			writeError(w, r, defaultEncoder, errors.E(errors.IO, errors.CodeServerError, "authentication unavailable"))
+			return
+		}
+
+		u, p, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(u), []byte(user)) != 1 || subtle.ConstantTimeCompare([]byte(p), want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="restricted", charset="UTF-8"`)
+			w.Header().Set("Content-Type", "application/json")
+			writeError(w, r, defaultEncoder, errors.E(errors.Invalid, errors.Code(http.StatusUnauthorized), "authentication required"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
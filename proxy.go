@@ -0,0 +1,123 @@
+package gomux
+
+import (
+	"context"
+	stderrors "errors"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hunterdishner/errors"
+)
+
+// ProxyOptions configures a Proxy route. Zero values fall back to the defaults noted on each field.
+type ProxyOptions struct {
+	// Rewrite maps the path below the route's path, e.g. "/orders/7" for "/legacy/orders/7", to the path sent
+	// upstream, which is joined to the target's path. Defaults to passing it unchanged.
+	Rewrite func(path string) string
+	// PreserveHost sends the client's Host header upstream instead of the target's host.
+	PreserveHost bool
+	// TrustForwarded appends to the X-Forwarded-For header the client sent instead of replacing it. Only set it
+	// behind proxies that sanitize the header.
+	TrustForwarded bool
+	// NoForwarded sends no X-Forwarded-For, X-Forwarded-Host or X-Forwarded-Proto headers.
+	NoForwarded bool
+	// Timeout bounds each upstream request including its response body. Zero leaves it unbounded.
+	Timeout time.Duration
+	// ResponseHeaderTimeout bounds the wait for the upstream's response headers. Defaults to 30s.
+	ResponseHeaderTimeout time.Duration
+	// ModifyResponse can rewrite upstream responses before they are sent; an error answers with a 502.
+	ModifyResponse func(*http.Response) error
+	// Transport sends the upstream requests. It replaces ResponseHeaderTimeout.
+	Transport http.RoundTripper
+}
+
+// proxyPathVar holds the part of the request path below a Proxy route's path.
+const proxyPathVar = "gomuxProxyPath"
+
+// Proxy returns a route forwarding every method on path and everything below it to target, e.g.
+// gomux.Proxy("/legacy", "http://orders.internal:8080/api", gomux.ProxyOptions{}) sends /svc/legacy/orders/7 to
+// http://orders.internal:8080/api/orders/7. Upstream failures are answered with a 502, timeouts with a 504.
+func Proxy(path, target string, opts ProxyOptions) Route {
+	route := Route{Path: strings.TrimSuffix("/"+strings.TrimPrefix(path, "/"), "/") + "{" + proxyPathVar + ":(?:/.*)?}"}
+
+	u, err := url.Parse(target)
+	if err == nil && (u.Scheme == "" || u.Host == "") {
+		err = stderrors.New("proxy target " + target + " needs a scheme and host")
+	}
+	if err != nil {
+		route.err = err
+		return route
+	}
+
+	if opts.ResponseHeaderTimeout == 0 {
+		opts.ResponseHeaderTimeout = 30 * time.Second
+	}
+	if opts.Transport == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.ResponseHeaderTimeout = opts.ResponseHeaderTimeout
+		opts.Transport = transport
+	}
+
+	rp := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			rest := mux.Vars(pr.In)[proxyPathVar]
+			if opts.Rewrite != nil {
+				rest = opts.Rewrite(rest)
+			}
+			pr.Out.URL.Path, pr.Out.URL.RawPath = rest, ""
+			pr.SetURL(u)
+			if rest == "" {
+				pr.Out.URL.Path, pr.Out.URL.RawPath = u.Path, u.RawPath
+			}
+
+			if opts.PreserveHost {
+				pr.Out.Host = pr.In.Host
+			}
+			if !opts.NoForwarded {
+				if opts.TrustForwarded {
+					pr.Out.Header["X-Forwarded-For"] = pr.In.Header["X-Forwarded-For"]
+				}
+				pr.SetXForwarded()
+			}
+		},
+		Transport:      opts.Transport,
+		ModifyResponse: opts.ModifyResponse,
+		ErrorHandler:   proxyError,
+	}
+
+	route.HandlerFunc = func(w http.ResponseWriter, r *http.Request) {
+		if opts.Timeout > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), opts.Timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+
+		rp.ServeHTTP(w, r)
+	}
+
+	return route
+}
+
+// proxyError answers a failed upstream request with a 504 when it timed out and a 502 otherwise.
+func proxyError(w http.ResponseWriter, r *http.Request, err error) {
+	code := http.StatusBadGateway
+	var netErr net.Error
+	if stderrors.Is(err, context.DeadlineExceeded) || stderrors.As(err, &netErr) && netErr.Timeout() {
+		code = http.StatusGatewayTimeout
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if bodyErr := bodyError(err); bodyErr != nil {
+		writeError(w, r, defaultEncoder, bodyErr)
+		return
+	}
+
+	log.Printf("%+v", errors.E(errors.IO, errors.Code(code), err))
+	writeError(w, r, defaultEncoder, errors.E(errors.IO, errors.Code(code), http.StatusText(code)))
+}
@@ -0,0 +1,117 @@
+package gomux
+
+import (
+	stderrors "errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/hunterdishner/errors"
+)
+
+var errSlowBody = stderrors.New("request body sent too slowly")
+
+// MinTransferRate closes connections of clients that trickle bytes to tie up the server: request heads must
+// arrive within grace, and once grace has passed, request bodies must keep arriving and responses keep being
+// accepted at bytesPerSecond on average. A body that falls behind fails to read, which handlers returning the
+// failure (and Bind) answer with a 408, and a response that falls behind is cut off. A rate that is not
+// positive, or a negative grace, is logged and no minimum is enforced.
+func MinTransferRate(bytesPerSecond int64, grace time.Duration) Option {
+	return func(s *Server) {
+		if bytesPerSecond <= 0 || grace < 0 {
+			log.Printf("%+v", errors.E(errors.Invalid, errors.CodeServerError, fmt.Sprintf("minimum transfer rate: %d bytes per second with a grace of %s is not valid", bytesPerSecond, grace)))
+			return
+		}
+
+		s.minRate = &transferRate{bytesPerSecond: bytesPerSecond, grace: grace}
+	}
+}
+
+type transferRate struct {
+	bytesPerSecond int64
+	grace          time.Duration
+}
+
+// allowance is how long transferring n bytes may take.
+func (t *transferRate) allowance(n int64) time.Duration {
+	return t.grace + time.Duration(float64(n)/float64(t.bytesPerSecond)*float64(time.Second))
+}
+
+// enforce holds the body and response of every request to the rate through deadlines on their connection.
+func (t *transferRate) enforce(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = &rateReader{ReadCloser: r.Body, rc: rc, rate: t}
+		}
+
+		next.ServeHTTP(&rateWriter{ResponseWriter: w, rc: rc, rate: t}, r)
+	})
+}
+
+// rateReader moves the read deadline along with the bytes read, to the point where the average rate since
+// the first read would drop below the minimum.
+type rateReader struct {
+	io.ReadCloser
+	rc   *http.ResponseController
+	rate *transferRate
+
+	start time.Time
+	n     int64
+	off   bool
+}
+
+func (b *rateReader) Read(p []byte) (int, error) {
+	if !b.off {
+		if b.start.IsZero() {
+			b.start = time.Now()
+		}
+		// Connections that cannot take deadlines, e.g. HTTP/3 streams, go unchecked.
+		if err := b.rc.SetReadDeadline(b.start.Add(b.rate.allowance(b.n))); err != nil {
+			b.off = true
+		}
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	switch {
+	case err == io.EOF && !b.off:
+		// net/http keeps reading the connection once the body is done, to notice the client going away.
+		b.rc.SetReadDeadline(time.Time{})
+	case err != nil && stderrors.Is(err, os.ErrDeadlineExceeded):
+		err = errSlowBody
+	}
+
+	return n, err
+}
+
+// rateWriter gives every write the time its size allows at the minimum rate.
+type rateWriter struct {
+	http.ResponseWriter
+	rc   *http.ResponseController
+	rate *transferRate
+
+	off bool
+}
+
+func (w *rateWriter) Write(b []byte) (int, error) {
+	if !w.off {
+		if err := w.rc.SetWriteDeadline(time.Now().Add(w.rate.allowance(int64(len(b))))); err != nil {
+			w.off = true
+		}
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *rateWriter) Flush() {
+	w.rc.Flush()
+}
+
+// Unwrap lets http.ResponseController reach the connection's writer.
+func (w *rateWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
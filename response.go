@@ -0,0 +1,119 @@
+package gomux
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ResponseInfo is what a request was answered with.
+type ResponseInfo struct {
+	// Status is the final status code written, 200 when the handler wrote nothing else.
+	Status int
+	// Bytes is the size of the body written, before any transfer encoding.
+	Bytes    int64
+	Duration time.Duration
+}
+
+// ResponseHook is called with every response once it has been served.
+type ResponseHook func(r *http.Request, info ResponseInfo)
+
+// OnResponse registers hooks called after every request the server handles, including CORS preflights and
+// requests matching no route, e.g. to log access lines or count status codes. Hooks run in the order given on
+// the request's goroutine, so slow ones delay the handler's return.
+func OnResponse(hooks ...ResponseHook) Option {
+	return func(s *Server) {
+		s.responseHooks = append(s.responseHooks, hooks...)
+	}
+}
+
+// ResponseOf returns what has been written to w so far, for middleware that needs the status or size a route
+// produced once the next handler returns. w has to be the writer the middleware was given, or wrap it with an
+// Unwrap method.
+func ResponseOf(w http.ResponseWriter) (ResponseInfo, bool) {
+	for w != nil {
+		if rw, ok := w.(*responseWriter); ok {
+			return rw.info(), true
+		}
+
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		w = u.Unwrap()
+	}
+
+	return ResponseInfo{}, false
+}
+
+// instrument wraps h so the status and size of every response are recorded and passed to the hooks.
+func instrument(h http.Handler, hooks []ResponseHook) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &responseWriter{ResponseWriter: w, start: time.Now()}
+		h.ServeHTTP(rw, r)
+
+		if len(hooks) == 0 {
+			return
+		}
+
+		info := rw.info()
+		for _, hook := range hooks {
+			hook(r, info)
+		}
+	})
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	start  time.Time
+	status int
+	bytes  int64
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	// 1xx responses other than 101 are informational and followed by the final status.
+	if w.status == 0 && (status >= 200 || status == http.StatusSwitchingProtocols) {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+
+	return n, err
+}
+
+func (w *responseWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack keeps websocket upgrades working for libraries asserting http.Hijacker.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the connection's writer.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *responseWriter) info() ResponseInfo {
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	return ResponseInfo{Status: status, Bytes: w.bytes, Duration: time.Since(w.start)}
+}
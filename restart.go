@@ -0,0 +1,138 @@
+package gomux
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hunterdishner/errors"
+)
+
+// listenersEnv lists the addresses of the sockets a process inherits from Restart, in the order of their file
+// descriptors starting at 3.
+const listenersEnv = "GOMUX_LISTENERS"
+
+// ReusePort binds the server's sockets with SO_REUSEPORT, so a new process can bind the same ports while this
+// one drains after its context is cancelled. It is not supported on Windows.
+func ReusePort() Option {
+	return func(s *Server) {
+		s.reusePort = true
+	}
+}
+
+// Restart starts a new copy of the running binary, with the same arguments and environment, that takes over
+// the server's listening sockets, so no connection is refused while it starts up. Cancel the server's context
+// once Restart returns to drain this process. The new process must configure the same ports.
+func (s *Server) Restart() error {
+	path, err := os.Executable()
+	if err != nil {
+		return errors.E(errors.CodeServerError, errors.IO, err)
+	}
+
+	s.listenMu.Lock()
+	var addrs []string
+	var files []*os.File
+	for addr, ln := range s.listeners {
+		fl, ok := ln.(interface{ File() (*os.File, error) })
+		if !ok {
+			continue
+		}
+		f, err := fl.File()
+		if err != nil {
+			s.listenMu.Unlock()
+			closeFiles(files)
+			return errors.E(errors.CodeServerError, errors.IO, err)
+		}
+		addrs = append(addrs, addr)
+		files = append(files, f)
+	}
+	s.listenMu.Unlock()
+	defer closeFiles(files)
+
+	env := []string{listenersEnv + "=" + strings.Join(addrs, ",")}
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, listenersEnv+"=") {
+			env = append(env, kv)
+		}
+	}
+
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = env
+	cmd.ExtraFiles = files
+	if err := cmd.Start(); err != nil {
+		return errors.E(errors.CodeServerError, errors.IO, err)
+	}
+
+	return cmd.Process.Release()
+}
+
+// Restart restarts the host's process, see Server.Restart.
+func (h *Host) Restart() error {
+	return h.s.Restart()
+}
+
+// listenTCP returns the listener for addr, taking over the one inherited from Restart when there is one.
+func (s *Server) listenTCP(addr string) (net.Listener, error) {
+	ln, err := inheritedListener(addr)
+	if ln == nil && err == nil {
+		lc := net.ListenConfig{}
+		if s.reusePort {
+			lc.Control = reusePort
+		}
+		ln, err = lc.Listen(context.Background(), "tcp", addr)
+	}
+	if err != nil {
+		return nil, errors.E(errors.CodeServerError, errors.IO, err)
+	}
+
+	s.listenMu.Lock()
+	if s.listeners == nil {
+		s.listeners = map[string]net.Listener{}
+	}
+	s.listeners[addr] = ln
+	s.listenMu.Unlock()
+
+	return ln, nil
+}
+
+var inherited struct {
+	once sync.Once
+	mu   sync.Mutex
+	fds  map[string]uintptr
+}
+
+// inheritedListener takes the socket for addr passed down by Restart, returning nil when there is none.
+func inheritedListener(addr string) (net.Listener, error) {
+	inherited.once.Do(func() {
+		inherited.fds = map[string]uintptr{}
+		if env := os.Getenv(listenersEnv); env != "" {
+			for i, a := range strings.Split(env, ",") {
+				inherited.fds[a] = uintptr(3 + i)
+			}
+		}
+	})
+
+	inherited.mu.Lock()
+	fd, ok := inherited.fds[addr]
+	delete(inherited.fds, addr)
+	inherited.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+
+	f := os.NewFile(fd, "listener "+addr+" fd "+strconv.Itoa(int(fd)))
+	defer f.Close()
+
+	return net.FileListener(f)
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
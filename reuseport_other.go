@@ -0,0 +1,12 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package gomux
+
+import (
+	stderrors "errors"
+	"syscall"
+)
+
+func reusePort(network, address string, c syscall.RawConn) error {
+	return stderrors.New("gomux: SO_REUSEPORT is not supported on this platform")
+}
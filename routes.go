@@ -0,0 +1,136 @@
+package gomux
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"github.com/hunterdishner/errors"
+)
+
+// RouteInfo describes a route that has been added to a Server.
+type RouteInfo struct {
+	Method       string   `json:"method"`
+	Path         string   `json:"path"`
+	Name         string   `json:"name,omitempty"`
+	Handler      string   `json:"handler"`
+	Environments []string `json:"environments,omitempty"`
+	// Middleware names the functions of the route's own middleware, outermost first.
+	Middleware []string `json:"middleware,omitempty"`
+	// Auth is the scheme authenticating the route, empty when there is none. See Authenticate.
+	Auth string `json:"auth,omitempty"`
+	// Enabled is false for routes that were not mounted because of their environment gating.
+	Enabled bool `json:"enabled"`
+}
+
+type mountedRoute struct {
+	Route
+	enabled bool
+}
+
+// OnlyIn restricts each of the given routes to the listed environments, e.g.
+// s.AddRoutes(gomux.OnlyIn([]string{"dev", "staging"}, gomux.Get("/debug/routes", s.RouteTable))...).
+func OnlyIn(envs []string, routes ...Route) []Route {
+	for i := range routes {
+		routes[i].Environments = envs
+	}
+
+	return routes
+}
+
+// FailOnRouteErrors makes Serve fail with Err instead of starting when any route passed to AddRoutes was
+// invalid, so typos in paths surface at startup rather than as 404s in production.
+func FailOnRouteErrors() Option {
+	return func(s *Server) {
+		s.failOnRouteErrors = true
+	}
+}
+
+// Err reports the routes AddRoutes could not register, or nil when all of them were.
+func (s *Server) Err() error {
+	if len(s.routeErrors) == 0 {
+		return nil
+	}
+
+	return errors.E(errors.Invalid, errors.Code(http.StatusUnprocessableEntity), "invalid routes: "+strings.Join(s.routeErrors, "; "))
+}
+
+// routeError logs a route AddRoutes could not register and records it for Err.
+func (s *Server) routeError(route Route, err error) {
+	log.Printf("%+v", errors.E(errors.Invalid, errors.Code(http.StatusUnprocessableEntity), err))
+	s.routeErrors = append(s.routeErrors, fmt.Sprintf("%s %s: %v", route.Method, route.Path, err))
+}
+
+// Routes returns the routing table in the order the routes were added.
+func (s *Server) Routes() []RouteInfo {
+	infos := make([]RouteInfo, 0, len(s.routes))
+	for _, route := range s.routes {
+		var middleware []string
+		for _, mw := range route.Middleware {
+			middleware = append(middleware, funcName(mw))
+		}
+
+		infos = append(infos, RouteInfo{
+			Method:       route.Method,
+			Path:         "/" + s.name + route.Path,
+			Name:         route.Name,
+			Handler:      handlerName(route.Route),
+			Environments: route.Environments,
+			Middleware:   middleware,
+			Auth:         route.Auth,
+			Enabled:      route.enabled,
+		})
+	}
+
+	return infos
+}
+
+// RouteTable is a ServiceHandler that dumps the routing table. Mount it like any other route, e.g.
+// gomux.Get("/debug/routes", s.RouteTable).
+func (s *Server) RouteTable(w io.Writer, r *http.Request) (interface{}, error) {
+	return s.Routes(), nil
+}
+
+// URL builds the path for the named route, including the server's name prefix. Params are key/value pairs
+// for the route's path variables, e.g. s.URL("user", "userid", "42").
+func (s *Server) URL(name string, params ...string) (string, error) {
+	route := s.mux.Get(name)
+	if route == nil {
+		return "", errors.E(errors.Invalid, errors.Code(http.StatusInternalServerError), fmt.Sprintf("no route named %q", name))
+	}
+
+	u, err := route.URLPath(params...)
+	if err != nil {
+		return "", errors.E(errors.Invalid, errors.Code(http.StatusInternalServerError), err)
+	}
+
+	return u.String(), nil
+}
+
+// handlerName resolves the function name backing a route so it can be identified in the routing table.
+func handlerName(route Route) string {
+	var fn interface{} = route.HandlerFunc
+	if route.Handler != nil {
+		fn = route.Handler
+	}
+
+	return funcName(fn)
+}
+
+// funcName returns the name of the function fn holds, empty when it holds none.
+func funcName(fn interface{}) string {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return ""
+	}
+
+	if f := runtime.FuncForPC(v.Pointer()); f != nil {
+		return f.Name()
+	}
+
+	return ""
+}
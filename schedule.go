@@ -0,0 +1,348 @@
+package gomux
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hunterdishner/errors"
+)
+
+// ScheduleOptions configures a scheduled task.
+type ScheduleOptions struct {
+	// Name identifies the task in logs and the admin /schedules report. Defaults to the spec.
+	Name string
+	// Jitter delays each run by a random duration up to Jitter, so instances do not all run at once.
+	Jitter time.Duration
+}
+
+// Schedule runs fn on the given schedule while the server serves, on the context shared by the workers of Go.
+// spec is either a five field cron expression (minute, hour, day of month, month, day of week, e.g.
+// "30 3 * * MON-FRI"), one of @yearly, @monthly, @weekly, @daily and @hourly, or "@every <duration>", e.g.
+// "@every 5m". Cron expressions are evaluated in local time.
+//
+// Runs never overlap: a run still going when the next is due makes the scheduler skip to the first time after
+// it ends, counting the skipped runs. Failed runs are logged and counted in the admin /schedules report.
+func (s *Server) Schedule(spec string, fn func(ctx context.Context) error) error {
+	return s.ScheduleWith(spec, ScheduleOptions{}, fn)
+}
+
+// ScheduleWith is Schedule with options.
+func (s *Server) ScheduleWith(spec string, opts ScheduleOptions, fn func(ctx context.Context) error) error {
+	sched, err := parseSchedule(spec)
+	if err != nil {
+		return errors.E(errors.Invalid, errors.CodeServerError, fmt.Sprintf("schedule %q: %v", spec, err))
+	}
+	if opts.Name == "" {
+		opts.Name = spec
+	}
+
+	t := &scheduledTask{opts: opts, sched: sched, fn: fn, stat: ScheduleStat{Name: opts.Name, Spec: spec}}
+	s.scheduleMu.Lock()
+	s.schedules = append(s.schedules, t)
+	s.scheduleMu.Unlock()
+
+	s.Go("schedule "+opts.Name, t.loop)
+	return nil
+}
+
+// ScheduleStat reports on a scheduled task.
+type ScheduleStat struct {
+	Name     string `json:"name"`
+	Spec     string `json:"spec"`
+	Running  bool   `json:"running"`
+	Runs     int    `json:"runs"`
+	Failures int    `json:"failures"`
+	// Skipped counts the runs left out because the previous run was still going.
+	Skipped      int        `json:"skipped"`
+	LastRun      *time.Time `json:"last_run,omitempty"`
+	LastDuration string     `json:"last_duration,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	Next         *time.Time `json:"next,omitempty"`
+}
+
+// Schedules reports on the tasks registered with Schedule, in the order they were registered.
+func (s *Server) Schedules() []ScheduleStat {
+	s.scheduleMu.Lock()
+	defer s.scheduleMu.Unlock()
+
+	stats := make([]ScheduleStat, 0, len(s.schedules))
+	for _, t := range s.schedules {
+		t.mu.Lock()
+		stats = append(stats, t.stat)
+		t.mu.Unlock()
+	}
+
+	return stats
+}
+
+func (s *Server) scheduleStats(w io.Writer, r *http.Request) (interface{}, error) {
+	return s.Schedules(), nil
+}
+
+type scheduledTask struct {
+	opts  ScheduleOptions
+	sched schedule
+	fn    func(ctx context.Context) error
+
+	mu   sync.Mutex
+	stat ScheduleStat
+}
+
+func (t *scheduledTask) loop(ctx context.Context) error {
+	next := t.sched.next(time.Now())
+	for {
+		if next.IsZero() {
+			return nil
+		}
+		due := next
+		t.mu.Lock()
+		t.stat.Next = &due
+		t.mu.Unlock()
+
+		wait := time.Until(next)
+		if t.opts.Jitter > 0 {
+			wait += time.Duration(rand.Int63n(int64(t.opts.Jitter)))
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+
+		t.run(ctx)
+
+		skipped := 0
+		for next = t.sched.next(next); !next.IsZero() && next.Before(time.Now()); next = t.sched.next(next) {
+			skipped++
+		}
+		if skipped > 0 {
+			t.mu.Lock()
+			t.stat.Skipped += skipped
+			t.mu.Unlock()
+		}
+	}
+}
+
+func (t *scheduledTask) run(ctx context.Context) {
+	start := time.Now()
+	t.mu.Lock()
+	t.stat.Running = true
+	t.mu.Unlock()
+
+	err := func() (err error) {
+		defer func() {
+			if v := recover(); v != nil {
+				err = fmt.Errorf("panic: %v", v)
+			}
+		}()
+		return t.fn(ctx)
+	}()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stat.Running = false
+	t.stat.Runs++
+	t.stat.LastRun, t.stat.LastDuration = &start, time.Since(start).String()
+	t.stat.LastError = ""
+	if err != nil && ctx.Err() == nil {
+		t.stat.Failures++
+		t.stat.LastError = err.Error()
+		log.Printf("%+v", errors.E(errors.IO, errors.CodeServerError, fmt.Sprintf("scheduled task %s failed: %v", t.opts.Name, err)))
+	}
+}
+
+// schedule returns the first time after t a task is due, or the zero time when it never is.
+type schedule interface {
+	next(t time.Time) time.Time
+}
+
+type every time.Duration
+
+func (e every) next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+// cronSchedule holds the allowed values of each field as bit sets.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny record an unrestricted field: only when both are restricted does either match a day.
+	domAny, dowAny bool
+}
+
+var scheduleDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	monthNames = []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}
+	dayNames   = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+)
+
+func parseSchedule(spec string) (schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if d, ok := strings.CutPrefix(spec, "@every "); ok {
+		interval, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil {
+			return nil, err
+		}
+		if interval <= 0 {
+			return nil, fmt.Errorf("interval must be positive")
+		}
+		return every(interval), nil
+	}
+	if expr, ok := scheduleDescriptors[spec]; ok {
+		spec = expr
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields, got %d", len(fields))
+	}
+
+	var c cronSchedule
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("minute: %v", err)
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("hour: %v", err)
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("day of month: %v", err)
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, fmt.Errorf("month: %v", err)
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7, dayNames); err != nil {
+		return nil, fmt.Errorf("day of week: %v", err)
+	}
+	// 7 is Sunday too.
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domAny, c.dowAny = strings.HasPrefix(fields[2], "*"), strings.HasPrefix(fields[4], "*")
+
+	return c, nil
+}
+
+// parseCronField parses a comma separated list of *, values and ranges, each with an optional /step. names, if
+// given, are accepted for the values from min on.
+func parseCronField(field string, min, max int, names []string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			rng = part[:i]
+		}
+
+		lo, hi := min, max
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			if lo, err = cronValue(bounds[0], min, max, names); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = cronValue(bounds[1], min, max, names); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				hi = max
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("invalid range %q", rng)
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+
+	return bits, nil
+}
+
+func cronValue(s string, min, max int, names []string) (int, error) {
+	for i, name := range names {
+		if strings.EqualFold(s, name) {
+			return min + i, nil
+		}
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < min || v > max {
+		return 0, fmt.Errorf("%q is not a value from %d to %d", s, min, max)
+	}
+
+	return v, nil
+}
+
+func (c cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// Any valid expression matches within four years, the cycle of leap days.
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = step(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location()))
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = step(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location()))
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = step(t, time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location()))
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+// step returns next, the start of the month, day or hour after t's. A next in a DST gap may be normalized to t or
+// before, e.g. 02:00 to 01:00 when clocks jump from 02:00 to 03:00, so t then moves on to its next hour instead.
+func step(t, next time.Time) time.Time {
+	if next.After(t) {
+		return next
+	}
+
+	return t.Add(time.Duration(60-t.Minute()) * time.Minute)
+}
+
+func (c cronSchedule) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+
+	return dom || dow
+}
@@ -0,0 +1,141 @@
+package gomux
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	utc := func(year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		spec  string
+		start time.Time
+		want  time.Time
+	}{
+		// 2024-01-01 is a Monday.
+		{"* * * * *", utc(2024, 1, 1, 10, 0).Add(30 * time.Second), utc(2024, 1, 1, 10, 1)},
+		{"0 0 * * *", utc(2024, 1, 1, 0, 0), utc(2024, 1, 2, 0, 0)},
+		{"@hourly", utc(2024, 1, 1, 10, 59), utc(2024, 1, 1, 11, 0)},
+		{"@weekly", utc(2024, 1, 1, 0, 0), utc(2024, 1, 7, 0, 0)},
+		{"@monthly", utc(2024, 1, 15, 0, 0), utc(2024, 2, 1, 0, 0)},
+		{"@yearly", utc(2024, 6, 1, 0, 0), utc(2025, 1, 1, 0, 0)},
+
+		// Steps, from the start of the field or of a value.
+		{"*/15 * * * *", utc(2024, 1, 1, 10, 1), utc(2024, 1, 1, 10, 15)},
+		{"5/15 * * * *", utc(2024, 1, 1, 10, 21), utc(2024, 1, 1, 10, 35)},
+		{"0-30/10 * * * *", utc(2024, 1, 1, 10, 31), utc(2024, 1, 1, 11, 0)},
+		{"*/15 9-17 * * *", utc(2024, 1, 1, 17, 50), utc(2024, 1, 2, 9, 0)},
+		{"0 8,12,18 * * *", utc(2024, 1, 1, 12, 0), utc(2024, 1, 1, 18, 0)},
+
+		// Names, alone, in lists and in ranges.
+		{"30 3 * * MON-FRI", utc(2024, 1, 5, 4, 0), utc(2024, 1, 8, 3, 30)},
+		{"0 0 * * sat,sun", utc(2024, 1, 1, 0, 0), utc(2024, 1, 6, 0, 0)},
+		{"0 0 1 JAN,JUL *", utc(2024, 2, 1, 0, 0), utc(2024, 7, 1, 0, 0)},
+		{"0 0 1 MAR-MAY *", utc(2024, 5, 1, 0, 0), utc(2025, 3, 1, 0, 0)},
+
+		// 7 is Sunday, like 0.
+		{"0 0 * * 7", utc(2024, 1, 1, 0, 0), utc(2024, 1, 7, 0, 0)},
+		{"0 0 * * 5-7", utc(2024, 1, 6, 12, 0), utc(2024, 1, 7, 0, 0)},
+
+		// A day matches either restricted field, but both when one of them is unrestricted.
+		{"0 0 13 * FRI", utc(2024, 1, 1, 0, 0), utc(2024, 1, 5, 0, 0)},
+		{"0 0 13 * FRI", utc(2024, 1, 12, 0, 0), utc(2024, 1, 13, 0, 0)},
+		{"0 0 13 * *", utc(2024, 1, 1, 0, 0), utc(2024, 1, 13, 0, 0)},
+		{"0 0 */2 * MON", utc(2024, 1, 1, 0, 0), utc(2024, 1, 15, 0, 0)},
+
+		// Month and year rollover.
+		{"0 0 31 * *", utc(2024, 1, 31, 0, 0), utc(2024, 3, 31, 0, 0)},
+		{"59 23 31 12 *", utc(2024, 12, 31, 23, 59), utc(2025, 12, 31, 23, 59)},
+		{"0 0 29 2 *", utc(2025, 1, 1, 0, 0), utc(2028, 2, 29, 0, 0)},
+
+		// Days that never come give up after five years.
+		{"0 0 30 2 *", utc(2024, 1, 1, 0, 0), time.Time{}},
+		{"0 0 31 4,6,9,11 *", utc(2024, 1, 1, 0, 0), time.Time{}},
+
+		{"@every 90s", utc(2024, 1, 1, 10, 0), utc(2024, 1, 1, 10, 1).Add(30 * time.Second)},
+	}
+
+	for _, tt := range tests {
+		sched, err := parseSchedule(tt.spec)
+		if err != nil {
+			t.Errorf("parseSchedule(%q): %v", tt.spec, err)
+			continue
+		}
+		if got := sched.next(tt.start); !got.Equal(tt.want) {
+			t.Errorf("%q after %s = %s, want %s", tt.spec, tt.start, got, tt.want)
+		}
+	}
+}
+
+func TestScheduleNextDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	local := func(year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, loc)
+	}
+
+	// On 2024-03-10 clocks jump from 02:00 to 03:00, and on 2024-11-03 back from 02:00 to 01:00.
+	tests := []struct {
+		spec  string
+		start time.Time
+		want  time.Time
+	}{
+		// A time in the gap does not exist that day.
+		{"30 2 * * *", local(2024, 3, 10, 0, 0), local(2024, 3, 11, 2, 30)},
+		{"0 * * * *", local(2024, 3, 10, 1, 30), local(2024, 3, 10, 3, 0)},
+		{"*/30 * * * *", local(2024, 3, 10, 1, 45), local(2024, 3, 10, 3, 0)},
+		{"0 3 * * *", local(2024, 3, 10, 0, 0), local(2024, 3, 10, 3, 0)},
+		{"30 1 * * *", local(2024, 11, 2, 12, 0), local(2024, 11, 3, 1, 30)},
+	}
+
+	for _, tt := range tests {
+		sched, err := parseSchedule(tt.spec)
+		if err != nil {
+			t.Errorf("parseSchedule(%q): %v", tt.spec, err)
+			continue
+		}
+		if got := sched.next(tt.start); !got.Equal(tt.want) {
+			t.Errorf("%q after %s = %s, want %s", tt.spec, tt.start, got, tt.want)
+		}
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 8",
+		"-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"1-2-3 * * * *",
+		"a * * * *",
+		"1,,2 * * * *",
+		"MON * * * *",
+		"* * * * FOO",
+		"* * * JAN-FOO *",
+		"@daily 1",
+		"@unknown",
+		"@every",
+		"@every 5",
+		"@every 0s",
+		"@every -1m",
+	} {
+		if _, err := parseSchedule(spec); err == nil {
+			t.Errorf("parseSchedule(%q) succeeded, want an error", spec)
+		}
+	}
+}
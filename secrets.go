@@ -0,0 +1,116 @@
+package gomux
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hunterdishner/errors"
+)
+
+// SecretProvider resolves secrets such as keys and passwords by name when they are needed, so they can live in
+// the environment, mounted files or a secret manager and be rotated without rebuilding or restarting.
+// Implementations must be safe for concurrent use.
+type SecretProvider interface {
+	Secret(ctx context.Context, name string) ([]byte, error)
+}
+
+// SecretFunc adapts a function, e.g. a call to a secret manager's client, to a SecretProvider.
+type SecretFunc func(ctx context.Context, name string) ([]byte, error)
+
+func (f SecretFunc) Secret(ctx context.Context, name string) ([]byte, error) {
+	return f(ctx, name)
+}
+
+// Secrets sets the provider the server's options resolve their secrets from, see Server.Secret.
+func Secrets(p SecretProvider) Option {
+	return func(s *Server) {
+		s.secrets = p
+	}
+}
+
+// Secret resolves the named secret from the provider set with Secrets.
+func (s *Server) Secret(ctx context.Context, name string) ([]byte, error) {
+	if s.secrets == nil {
+		return nil, errors.E(errors.Invalid, errors.CodeServerError, "no secret provider configured")
+	}
+
+	return s.secrets.Secret(ctx, name)
+}
+
+// EnvSecrets reads each secret from the environment variable named prefix+name.
+func EnvSecrets(prefix string) SecretProvider {
+	return SecretFunc(func(ctx context.Context, name string) ([]byte, error) {
+		v, ok := os.LookupEnv(prefix + name)
+		if !ok {
+			return nil, errors.E(errors.Invalid, errors.CodeServerError, "secret "+name+" not set")
+		}
+
+		return []byte(v), nil
+	})
+}
+
+// FileSecrets reads each secret from the file of that name in dir, as Docker and Kubernetes mount them, with the
+// trailing newline removed. Files are read on every call, so wrap it in CachedSecrets on hot paths.
+func FileSecrets(dir string) SecretProvider {
+	return SecretFunc(func(ctx context.Context, name string) ([]byte, error) {
+		if name != filepath.Base(name) {
+			return nil, errors.E(errors.Invalid, errors.CodeServerError, "invalid secret name "+name)
+		}
+
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, errors.E(errors.IO, errors.CodeServerError, err)
+		}
+
+		return bytes.TrimRight(b, "\r\n"), nil
+	})
+}
+
+// CachedSecrets caches the secrets of p for ttl, so rotated values are picked up within ttl without fetching
+// on every request. When a refresh fails, the last value keeps being used and the error is logged.
+func CachedSecrets(p SecretProvider, ttl time.Duration) SecretProvider {
+	return &cachedSecrets{provider: p, ttl: ttl, entries: map[string]cachedSecret{}}
+}
+
+type cachedSecrets struct {
+	provider SecretProvider
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachedSecret
+}
+
+type cachedSecret struct {
+	value   []byte
+	fetched time.Time
+}
+
+func (c *cachedSecrets) Secret(ctx context.Context, name string) ([]byte, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[name]
+	c.mu.Unlock()
+
+	if ok && time.Since(entry.fetched) < c.ttl {
+		return entry.value, nil
+	}
+
+	value, err := c.provider.Secret(ctx, name)
+	if err != nil {
+		if ok {
+			log.Printf("%+v", errors.E(errors.IO, errors.CodeServerError, err))
+			return entry.value, nil
+		}
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.entries[name] = cachedSecret{value: value, fetched: time.Now()}
+	c.mu.Unlock()
+
+	return value, nil
+}
@@ -0,0 +1,140 @@
+package gomux
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/hunterdishner/errors"
+)
+
+// Example is a request SelfTest sends to a route.
+type Example struct {
+	// Path is the concrete path to request, e.g. "/users/42" for "/users/{id}". Defaults to the route's path.
+	Path   string
+	Query  url.Values
+	Header http.Header
+	// Body is encoded as JSON unless it is a string or []byte.
+	Body interface{}
+	// Status is the expected response status. Zero accepts any 2xx.
+	Status int
+}
+
+// WithExamples returns a copy of the route with the given examples for SelfTest.
+func (r Route) WithExamples(examples ...Example) Route {
+	r.Examples = append(append([]Example(nil), r.Examples...), examples...)
+	return r
+}
+
+// SelfTestResult is the outcome of one SelfTest request.
+type SelfTestResult struct {
+	Method string `json:"method"`
+	// Route is the path template of the route, Path what was requested.
+	Route  string `json:"route"`
+	Path   string `json:"path"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// SelfTest sends every route its examples through the server's full handler chain, in process, and returns
+// the results, failing when any of them did. Routes without examples are only requested when that is free of
+// side effects: GETs without path variables, which pass unless they answer with a 5xx. It serves as a deploy
+// gate, e.g. run before the instance reports ready through a Health check.
+//
+// Examples pass through the server's middleware, so they need whatever it requires, such as auth headers.
+func (s *Server) SelfTest(ctx context.Context) ([]SelfTestResult, error) {
+	h := s.handler()
+
+	var results []SelfTestResult
+	var failed []string
+	for _, route := range s.routes {
+		if !route.enabled {
+			continue
+		}
+
+		examples := route.Examples
+		if len(examples) == 0 {
+			if route.Method != http.MethodGet || strings.Contains(route.Path, "{") {
+				continue
+			}
+			examples = []Example{{Status: -1}}
+		}
+
+		for _, ex := range examples {
+			res := s.selfTest(ctx, h, route.Route, ex)
+			if res.Error != "" {
+				failed = append(failed, fmt.Sprintf("%s %s: %s", res.Method, res.Path, res.Error))
+			}
+			results = append(results, res)
+		}
+	}
+
+	if len(failed) > 0 {
+		return results, errors.E(errors.Invalid, errors.CodeServerError, fmt.Sprintf("self test failed for %d of %d requests: %s", len(failed), len(results), strings.Join(failed, "; ")))
+	}
+
+	return results, nil
+}
+
+// selfTest sends one example to the route. A Status of -1 accepts anything but a 5xx.
+func (s *Server) selfTest(ctx context.Context, h http.Handler, route Route, ex Example) SelfTestResult {
+	path := ex.Path
+	if path == "" {
+		path = route.Path
+	}
+	path = "/" + s.name + "/" + strings.TrimPrefix(path, "/")
+
+	res := SelfTestResult{Method: route.Method, Route: "/" + s.name + route.Path, Path: path}
+
+	var body io.Reader
+	switch b := ex.Body.(type) {
+	case nil:
+	case string:
+		body = strings.NewReader(b)
+	case []byte:
+		body = bytes.NewReader(b)
+	default:
+		encoded, err := json.Marshal(b)
+		if err != nil {
+			res.Error = err.Error()
+			return res
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	target := path
+	if len(ex.Query) > 0 {
+		target += "?" + ex.Query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, route.Method, target, body)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	for k, v := range ex.Header {
+		req.Header[k] = v
+	}
+	if body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	res.Status = rec.Code
+
+	switch {
+	case ex.Status == -1 && rec.Code >= 500,
+		ex.Status == 0 && (rec.Code < 200 || rec.Code > 299),
+		ex.Status > 0 && rec.Code != ex.Status:
+		res.Error = fmt.Sprintf("unexpected status %d: %s", rec.Code, strings.TrimSpace(rec.Body.String()))
+	}
+
+	return res
+}
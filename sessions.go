@@ -0,0 +1,326 @@
+package gomux
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/hunterdishner/errors"
+)
+
+// SessionOptions configures sessions. Zero values fall back to the defaults noted on each field.
+type SessionOptions struct {
+	// Store keeps sessions on the server, e.g. in Redis or SQL behind a CacheStore, with only a random ID in the
+	// cookie. Without one the session itself is kept in the cookie, encrypted with Key, which suits small
+	// sessions up to about 3KB.
+	Store CacheStore
+	// Key encrypts cookie sessions with AES-GCM and must be 16, 24 or 32 bytes long. Required without a Store.
+	Key []byte
+	// CookieName defaults to "session".
+	CookieName string
+	// MaxAge is how long a session lives after its last change. Defaults to 24 hours.
+	MaxAge time.Duration
+	// Path defaults to "/".
+	Path   string
+	Domain string
+	// SameSite defaults to http.SameSiteLaxMode.
+	SameSite http.SameSite
+	// Insecure drops the Secure attribute from the cookie, for local development over plain HTTP.
+	Insecure bool
+}
+
+type sessionKey struct{}
+
+// Sessions loads the session of every request before the handler runs and saves it, when it was changed, before
+// the response is written. Handlers reach it through SessionFrom. A session that fails to load, e.g. because it
+// expired or the key changed, is replaced by an empty one.
+func Sessions(opts SessionOptions) Option {
+	if opts.CookieName == "" {
+		opts.CookieName = "session"
+	}
+	if opts.MaxAge == 0 {
+		opts.MaxAge = 24 * time.Hour
+	}
+	if opts.Path == "" {
+		opts.Path = "/"
+	}
+	if opts.SameSite == 0 {
+		opts.SameSite = http.SameSiteLaxMode
+	}
+
+	return func(s *Server) {
+		var aead cipher.AEAD
+		if opts.Store == nil {
+			block, err := aes.NewCipher(opts.Key)
+			if err == nil {
+				aead, err = cipher.NewGCM(block)
+			}
+			if err != nil {
+				// Serving without the sessions handlers rely on could skip their checks, so fail every request.
+				err = errors.E(errors.Invalid, errors.CodeServerError, fmt.Sprintf("sessions: %v", err))
+				log.Printf("%+v", err)
+				s.middleware = append(s.middleware, func(http.Handler) http.Handler {
+					return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						w.Header().Set("Content-Type", "application/json")
+						writeError(w, r, defaultEncoder, err)
+					})
+				})
+				return
+			}
+		}
+
+		m := &sessionManager{opts: opts, aead: aead}
+		s.middleware = append(s.middleware, m.handler)
+	}
+}
+
+// Session holds the values of a client's session. Values are stored as JSON.
+type Session struct {
+	id      string
+	values  map[string]json.RawMessage
+	changed bool
+	renewed string
+	destroy bool
+}
+
+// SessionFrom returns the session of the request, or nil when Sessions is not enabled.
+func SessionFrom(r *http.Request) *Session {
+	sess, _ := r.Context().Value(sessionKey{}).(*Session)
+	return sess
+}
+
+// Get decodes the value stored under key into v, reporting false when there is none or it does not fit v.
+func (s *Session) Get(key string, v interface{}) bool {
+	raw, ok := s.values[key]
+	return ok && json.Unmarshal(raw, v) == nil
+}
+
+// Set stores value under key.
+func (s *Session) Set(key string, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return errors.E(errors.Encoding, errors.CodeServerError, err)
+	}
+
+	s.values[key] = raw
+	s.changed = true
+	return nil
+}
+
+// Delete removes the value stored under key.
+func (s *Session) Delete(key string) {
+	if _, ok := s.values[key]; ok {
+		delete(s.values, key)
+		s.changed = true
+	}
+}
+
+// Renew keeps the values but moves them to a new session ID, which should be done on login so an ID planted
+// before it is worthless.
+func (s *Session) Renew() {
+	if s.renewed == "" {
+		s.renewed = s.id
+	}
+	s.id, s.changed = "", true
+}
+
+// Destroy removes the session and its cookie, e.g. on logout.
+func (s *Session) Destroy() {
+	s.values, s.destroy, s.changed = map[string]json.RawMessage{}, true, true
+}
+
+type sessionManager struct {
+	opts SessionOptions
+	aead cipher.AEAD
+}
+
+// sessionRecord is what is stored for a session.
+type sessionRecord struct {
+	Values  map[string]json.RawMessage `json:"v"`
+	Expires int64                      `json:"e"`
+}
+
+func (m *sessionManager) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess := m.load(r)
+		sw := &sessionWriter{ResponseWriter: w, save: func() { m.save(w, r, sess) }}
+
+		next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), sessionKey{}, sess)))
+		sw.saveOnce()
+	})
+}
+
+func (m *sessionManager) load(r *http.Request) *Session {
+	sess := &Session{values: map[string]json.RawMessage{}}
+
+	c, err := r.Cookie(m.opts.CookieName)
+	if err != nil || c.Value == "" {
+		return sess
+	}
+
+	var data []byte
+	if m.opts.Store != nil {
+		var ok bool
+		if data, ok, err = m.opts.Store.Get(r.Context(), "session/"+c.Value); err != nil {
+			log.Printf("%+v", errors.E(errors.IO, errors.CodeServerError, err))
+		}
+		if !ok {
+			return sess
+		}
+		sess.id = c.Value
+	} else if data, err = m.open(c.Value); err != nil {
+		return sess
+	}
+
+	var rec sessionRecord
+	if err := json.Unmarshal(data, &rec); err != nil || time.Now().Unix() > rec.Expires {
+		sess.id = ""
+		return sess
+	}
+	if rec.Values != nil {
+		sess.values = rec.Values
+	}
+
+	return sess
+}
+
+// save writes a changed session to the store and the cookie.
+func (m *sessionManager) save(w http.ResponseWriter, r *http.Request, sess *Session) {
+	if !sess.changed {
+		return
+	}
+
+	ctx := r.Context()
+	if m.opts.Store != nil && sess.renewed != "" {
+		if err := m.opts.Store.DeletePrefix(ctx, "session/"+sess.renewed); err != nil {
+			log.Printf("%+v", errors.E(errors.IO, errors.CodeServerError, err))
+		}
+	}
+
+	cookie := &http.Cookie{
+		Name:     m.opts.CookieName,
+		Path:     m.opts.Path,
+		Domain:   m.opts.Domain,
+		Secure:   !m.opts.Insecure,
+		HttpOnly: true,
+		SameSite: m.opts.SameSite,
+	}
+
+	if sess.destroy {
+		if m.opts.Store != nil && sess.id != "" {
+			if err := m.opts.Store.DeletePrefix(ctx, "session/"+sess.id); err != nil {
+				log.Printf("%+v", errors.E(errors.IO, errors.CodeServerError, err))
+			}
+		}
+		cookie.MaxAge = -1
+		http.SetCookie(w, cookie)
+		return
+	}
+
+	expires := time.Now().Add(m.opts.MaxAge)
+	data, err := json.Marshal(sessionRecord{Values: sess.values, Expires: expires.Unix()})
+	if err != nil {
+		log.Printf("%+v", errors.E(errors.Encoding, errors.CodeServerError, err))
+		return
+	}
+
+	if m.opts.Store != nil {
+		if sess.id == "" {
+			if sess.id, err = newSessionID(); err != nil {
+				log.Printf("%+v", err)
+				return
+			}
+		}
+		if err := m.opts.Store.Set(ctx, "session/"+sess.id, data, m.opts.MaxAge); err != nil {
+			log.Printf("%+v", errors.E(errors.IO, errors.CodeServerError, err))
+			return
+		}
+		cookie.Value = sess.id
+	} else {
+		if cookie.Value, err = m.seal(data); err != nil {
+			log.Printf("%+v", err)
+			return
+		}
+		if len(cookie.Value) > 4000 {
+			log.Printf("%+v", errors.E(errors.Invalid, errors.CodeServerError, fmt.Sprintf("session of %d bytes is too large for a cookie, use a Store", len(cookie.Value))))
+			return
+		}
+	}
+
+	cookie.Expires, cookie.MaxAge = expires, int(m.opts.MaxAge/time.Second)
+	http.SetCookie(w, cookie)
+}
+
+// seal encrypts a cookie session, binding it to the cookie name.
+func (m *sessionManager) seal(data []byte) (string, error) {
+	nonce := make([]byte, m.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", errors.E(errors.IO, errors.CodeServerError, err)
+	}
+
+	sealed := m.aead.Seal(nonce, nonce, data, []byte(m.opts.CookieName))
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+func (m *sessionManager) open(value string) ([]byte, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(sealed) < m.aead.NonceSize() {
+		return nil, fmt.Errorf("malformed session cookie")
+	}
+
+	nonce := sealed[:m.aead.NonceSize()]
+	return m.aead.Open(nil, nonce, sealed[len(nonce):], []byte(m.opts.CookieName))
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.E(errors.IO, errors.CodeServerError, err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// sessionWriter saves the session just before the response head is written, while cookies can still be set.
+type sessionWriter struct {
+	http.ResponseWriter
+	save  func()
+	saved bool
+}
+
+func (w *sessionWriter) saveOnce() {
+	if !w.saved {
+		w.saved = true
+		w.save()
+	}
+}
+
+func (w *sessionWriter) WriteHeader(status int) {
+	if status >= 200 || status == http.StatusSwitchingProtocols {
+		w.saveOnce()
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *sessionWriter) Write(b []byte) (int, error) {
+	w.saveOnce()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *sessionWriter) Flush() {
+	w.saveOnce()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *sessionWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,179 @@
+package gomux
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/hunterdishner/errors"
+)
+
+// ShedOptions configures LoadShedding and ShedRoutes. Zero values fall back to the defaults noted on each field.
+type ShedOptions struct {
+	// MaxInFlight is how many requests are handled at once. Required: LoadShedding without it logs an error and
+	// sets no limit, and ShedRoutes without it fails the routes in AddRoutes.
+	MaxInFlight int
+	// QueueDepth is how many requests beyond MaxInFlight wait for a slot. Zero sheds them straight away.
+	QueueDepth int
+	// QueueTimeout is how long a queued request waits before it is shed. Defaults to 100ms, since a request
+	// waiting longer mostly adds to the latency it was meant to protect.
+	QueueTimeout time.Duration
+	// Status answers shed requests, e.g. 429 for clients expected to slow down. Defaults to 503.
+	Status int
+	// RetryAfter is sent with shed requests. Defaults to a second.
+	RetryAfter time.Duration
+}
+
+// ShedStat reports on a load shedding limit.
+type ShedStat struct {
+	// Scope is "server" for LoadShedding, else the method and path of the route.
+	Scope       string `json:"scope"`
+	MaxInFlight int    `json:"max_in_flight"`
+	QueueDepth  int    `json:"queue_depth"`
+	InFlight    int64  `json:"in_flight"`
+	Queued      int64  `json:"queued"`
+	Served      uint64 `json:"served"`
+	Shed        uint64 `json:"shed"`
+}
+
+// LoadShedding caps the requests the server handles at once, queueing up to opts.QueueDepth more for at most
+// opts.QueueTimeout and shedding the rest with opts.Status and a Retry-After, so latency holds up under
+// overload instead of every request slowing down. The limit covers every route; ShedRoutes adds tighter ones
+// for single routes. Limits are reported by the admin /shedding endpoint and ShedStats.
+func LoadShedding(opts ShedOptions) Option {
+	return func(s *Server) {
+		l, err := newShedLimiter("server", opts)
+		if err != nil {
+			log.Printf("%+v", errors.E(errors.Invalid, errors.CodeServerError, err))
+			return
+		}
+		s.shed = l
+		s.middleware = append(s.middleware, l.limit)
+	}
+}
+
+// ShedRoutes gives each of the given routes its own limit, within any LoadShedding limit, e.g. for an
+// expensive report endpoint. Unlike Bulkhead, the routes do not share their slots and requests can queue.
+func ShedRoutes(opts ShedOptions, routes ...Route) []Route {
+	for i := range routes {
+		l, err := newShedLimiter(routes[i].Method+" "+routes[i].Path, opts)
+		if err != nil {
+			routes[i].err = err
+			continue
+		}
+		routes[i].shed = l
+	}
+
+	return routes
+}
+
+// ShedStats reports on the LoadShedding limit followed by those of the mounted routes.
+func (s *Server) ShedStats() []ShedStat {
+	var stats []ShedStat
+	if s.shed != nil {
+		stats = append(stats, s.shed.stat())
+	}
+	for _, route := range s.routes {
+		if route.enabled && route.shed != nil {
+			stat := route.shed.stat()
+			stat.Scope = route.Method + " /" + s.name + route.Path
+			stats = append(stats, stat)
+		}
+	}
+
+	return stats
+}
+
+func (s *Server) shedStats(w io.Writer, r *http.Request) (interface{}, error) {
+	return s.ShedStats(), nil
+}
+
+type shedLimiter struct {
+	scope string
+	opts  ShedOptions
+	slots chan struct{}
+
+	queued       int64
+	served, shed uint64
+}
+
+func newShedLimiter(scope string, opts ShedOptions) (*shedLimiter, error) {
+	if opts.MaxInFlight <= 0 {
+		return nil, fmt.Errorf("load shedding for %s needs a positive MaxInFlight, got %d", scope, opts.MaxInFlight)
+	}
+	if opts.QueueTimeout == 0 {
+		opts.QueueTimeout = 100 * time.Millisecond
+	}
+	if opts.Status == 0 {
+		opts.Status = http.StatusServiceUnavailable
+	}
+	if opts.RetryAfter == 0 {
+		opts.RetryAfter = time.Second
+	}
+
+	return &shedLimiter{scope: scope, opts: opts, slots: make(chan struct{}, opts.MaxInFlight)}, nil
+}
+
+func (l *shedLimiter) limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !l.acquire(r) {
+			atomic.AddUint64(&l.shed, 1)
+			l.reject(w, r)
+			return
+		}
+		defer func() { <-l.slots }()
+
+		atomic.AddUint64(&l.served, 1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// acquire takes a slot, queueing for one when the queue has room.
+func (l *shedLimiter) acquire(r *http.Request) bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if atomic.AddInt64(&l.queued, 1) > int64(l.opts.QueueDepth) {
+		atomic.AddInt64(&l.queued, -1)
+		return false
+	}
+	defer atomic.AddInt64(&l.queued, -1)
+
+	timer := time.NewTimer(l.opts.QueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+func (l *shedLimiter) reject(w http.ResponseWriter, r *http.Request) {
+	secs := int((l.opts.RetryAfter + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	w.Header().Set("Content-Type", "application/json")
+	writeError(w, r, defaultEncoder, errors.E(errors.HTTP, errors.Code(l.opts.Status), fmt.Sprintf("%s is overloaded", l.scope)))
+}
+
+func (l *shedLimiter) stat() ShedStat {
+	return ShedStat{
+		Scope:       l.scope,
+		MaxInFlight: l.opts.MaxInFlight,
+		QueueDepth:  l.opts.QueueDepth,
+		InFlight:    int64(len(l.slots)),
+		Queued:      atomic.LoadInt64(&l.queued),
+		Served:      atomic.LoadUint64(&l.served),
+		Shed:        atomic.LoadUint64(&l.shed),
+	}
+}
@@ -0,0 +1,132 @@
+package gomux
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+)
+
+// coalesceVary lists the request headers that take part in the coalescing key, so one client is never served
+// another's response.
+var coalesceVary = []string{"Authorization", "Cookie", "Accept", "Accept-Encoding", "Accept-Language", "If-None-Match"}
+
+// Coalesce makes each of the given GET routes run its handler once for concurrent identical requests, those with
+// the same path, query, credentials and TLS client certificate, and serve the result to all of them. It suits
+// expensive read endpoints that see bursts of the same request, e.g. after a cache expires. Routes whose
+// responses depend on anything else, e.g. an API key header or the client address, use CoalesceBy.
+//
+// The shared execution runs on a context detached from the cancellation of the request that started it, so a
+// client going away does not fail the others waiting on it.
+func Coalesce(routes ...Route) []Route {
+	for i := range routes {
+		routes[i].Coalesce = true
+	}
+
+	return routes
+}
+
+// CoalesceBy is Coalesce with requests only shared between those for which scope returns the same value as
+// well, e.g. gomux.CoalesceBy(func(r *http.Request) string { return r.Header.Get("X-API-Key") }, routes...).
+func CoalesceBy(scope func(r *http.Request) string, routes ...Route) []Route {
+	for i := range routes {
+		routes[i].Coalesce = true
+		routes[i].coalesceScope = scope
+	}
+
+	return routes
+}
+
+// flightGroup coalesces the requests of one route.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+type flight struct {
+	done chan struct{}
+	resp *bufferedResponse
+}
+
+func coalesce(tmpl string, scope func(r *http.Request) string, next http.Handler) http.Handler {
+	g := &flightGroup{flights: map[string]*flight{}}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := cacheKey(tmpl, r, coalesceVary)
+		if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+			sum := sha256.Sum256(r.TLS.PeerCertificates[0].Raw)
+			key += "\x00" + hex.EncodeToString(sum[:])
+		}
+		if scope != nil {
+			key += "\x00" + scope(r)
+		}
+
+		g.mu.Lock()
+		f, ok := g.flights[key]
+		if !ok {
+			f = &flight{done: make(chan struct{})}
+			g.flights[key] = f
+		}
+		g.mu.Unlock()
+
+		if !ok {
+			resp := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+			func() {
+				defer func() {
+					if v := recover(); v != nil {
+						// Waiters get a bare 500 while the panic goes on to the leader's recovery.
+						resp = &bufferedResponse{header: http.Header{}, status: http.StatusInternalServerError}
+						defer panic(v)
+					}
+					g.mu.Lock()
+					delete(g.flights, key)
+					g.mu.Unlock()
+					f.resp = resp
+					close(f.done)
+				}()
+				next.ServeHTTP(resp, r.WithContext(context.WithoutCancel(r.Context())))
+			}()
+		} else {
+			select {
+			case <-f.done:
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		f.resp.copyTo(w)
+	})
+}
+
+// bufferedResponse records a response so it can be written to several clients.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+	wrote  bool
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if !b.wrote {
+		b.status, b.wrote = status, true
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.wrote = true
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponse) copyTo(w http.ResponseWriter) {
+	for k, v := range b.header {
+		w.Header()[k] = append([]string(nil), v...)
+	}
+	w.WriteHeader(b.status)
+	w.Write(b.body.Bytes())
+}
@@ -0,0 +1,188 @@
+package gomux
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/hunterdishner/errors"
+)
+
+const (
+	soap11Namespace = "http://schemas.xmlsoap.org/soap/envelope/"
+	soap12Namespace = "http://www.w3.org/2003/05/soap-envelope"
+
+	soap11ContentType = "text/xml"
+	soap12ContentType = "application/soap+xml"
+)
+
+// SOAPAction maps a SOAP action onto a ServiceHandler. The handler reads the contents of the envelope's Body
+// from r.Body (see SOAPBody) and its return value is marshaled as XML into the response Body.
+type SOAPAction struct {
+	Action  string
+	Handler ServiceHandler
+}
+
+// SOAP is a convenience function for creating a POST route that accepts SOAP 1.1 and 1.2 envelopes and
+// dispatches them to the handler registered for the request's action. The action is taken from the
+// SOAPAction header (1.1) or the action parameter of the Content-Type (1.2), falling back to the name of
+// the first element in the envelope Body. Handler errors are rendered as SOAP faults.
+func SOAP(path string, actions ...SOAPAction) Route {
+	handlers := make(map[string]ServiceHandler, len(actions))
+	for _, a := range actions {
+		handlers[a.Action] = a.Handler
+	}
+
+	return PostFn(path, func(w http.ResponseWriter, r *http.Request) {
+		version, action := soapVersion(r)
+
+		var env soapEnvelope
+		if err := xml.NewDecoder(r.Body).Decode(&env); err != nil {
+			writeSOAPFault(w, version, errors.E(errors.Encoding, errors.CodeBadRequest, err))
+			return
+		}
+
+		if action == "" {
+			action = env.Body.firstElement()
+		}
+
+		fn, ok := handlers[action]
+		if !ok {
+			writeSOAPFault(w, version, errors.E(errors.Invalid, errors.CodeBadRequest, "unknown SOAP action "+action))
+			return
+		}
+
+		req := r.Clone(r.Context())
+		req.Body = io.NopCloser(bytes.NewReader(env.Body.Inner))
+		req.ContentLength = int64(len(env.Body.Inner))
+
+		data, err := fn(w, req)
+		if err != nil {
+			writeSOAPFault(w, version, err)
+			return
+		}
+
+		var inner []byte
+		if data != nil {
+			if inner, err = xml.Marshal(data); err != nil {
+				writeSOAPFault(w, version, errors.E(errors.Encoding, errors.CodeServerError, err))
+				return
+			}
+		}
+
+		writeSOAPEnvelope(w, version, http.StatusOK, inner)
+	})
+}
+
+// SOAPBody decodes the contents of the envelope Body handed to a SOAPAction handler into v.
+func SOAPBody(r *http.Request, v interface{}) error {
+	if err := xml.NewDecoder(r.Body).Decode(v); err != nil {
+		return errors.E(errors.Encoding, errors.CodeBadRequest, err)
+	}
+
+	return nil
+}
+
+type soapEnvelope struct {
+	XMLName xml.Name
+	Body    soapBody `xml:"Body"`
+}
+
+type soapBody struct {
+	Inner []byte `xml:",innerxml"`
+}
+
+// firstElement returns the local name of the first element in the body or an empty string.
+func (b soapBody) firstElement() string {
+	dec := xml.NewDecoder(bytes.NewReader(b.Inner))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return ""
+		}
+
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name.Local
+		}
+	}
+}
+
+// soapVersion reports the SOAP version of the request (11 or 12) and the action it names, if any.
+func soapVersion(r *http.Request) (int, string) {
+	mediatype, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediatype == soap12ContentType {
+		return 12, params["action"]
+	}
+
+	return 11, strings.Trim(r.Header.Get("SOAPAction"), `"`)
+}
+
+func writeSOAPEnvelope(w http.ResponseWriter, version, status int, inner []byte) {
+	namespace, contentType := soap11Namespace, soap11ContentType
+	if version == 12 {
+		namespace, contentType = soap12Namespace, soap12ContentType
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<soap:Envelope xmlns:soap="` + namespace + `"><soap:Body>`)
+	buf.Write(inner)
+	buf.WriteString(`</soap:Body></soap:Envelope>`)
+
+	w.Header().Set("Content-Type", contentType+"; charset=utf-8")
+	w.WriteHeader(status)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		log.Printf("%+v", errors.E(errors.IO, errors.CodeServerError, err))
+	}
+}
+
+type soap11Fault struct {
+	XMLName xml.Name `xml:"soap:Fault"`
+	Code    string   `xml:"faultcode"`
+	String  string   `xml:"faultstring"`
+}
+
+type soap12Fault struct {
+	XMLName xml.Name `xml:"soap:Fault"`
+	Code    string   `xml:"soap:Code>soap:Value"`
+	Reason  string   `xml:"soap:Reason>soap:Text"`
+}
+
+// writeSOAPFault renders err as a fault. Errors carrying a 4xx code are reported as client (sender) faults,
+// everything else as server (receiver) faults.
+func writeSOAPFault(w http.ResponseWriter, version int, err error) {
+	status := http.StatusInternalServerError
+	if e, ok := err.(*errors.Error); ok && e.Code >= 400 && e.Code < 500 {
+		status = int(e.Code)
+	}
+	client := status < http.StatusInternalServerError
+
+	var fault interface{}
+	if version == 12 {
+		f := soap12Fault{Code: "soap:Receiver", Reason: err.Error()}
+		if client {
+			f.Code = "soap:Sender"
+		}
+		fault = f
+	} else {
+		f := soap11Fault{Code: "soap:Server", String: err.Error()}
+		if client {
+			f.Code = "soap:Client"
+		}
+		fault = f
+		status = http.StatusInternalServerError // SOAP 1.1 reports every fault as a 500
+	}
+
+	inner, merr := xml.Marshal(fault)
+	if merr != nil {
+		log.Printf("%+v", errors.E(errors.Encoding, errors.CodeServerError, merr))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeSOAPEnvelope(w, version, status, inner)
+}
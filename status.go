@@ -0,0 +1,169 @@
+package gomux
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hunterdishner/errors"
+)
+
+// StatusCoder is implemented by values returned from a ServiceHandler that choose their own success status,
+// e.g. 201 for a created resource. The value itself is still encoded as the body.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// Respond returns body to be sent with status instead of 200, e.g.
+//
+//	return gomux.Respond(http.StatusCreated, user), nil
+//
+// A nil body, like any 204 or 304, is sent without one.
+func Respond(status int, body interface{}) interface{} {
+	return response{status: status, body: body}
+}
+
+type response struct {
+	status int
+	body   interface{}
+}
+
+func (r response) StatusCode() int {
+	return r.status
+}
+
+// successStatus splits what a ServiceHandler returned into the status to write and the value to encode. A nil
+// value is answered with a 204, as is a nil StatusCoder pointer, whose StatusCode cannot be asked.
+func successStatus(data interface{}) (int, interface{}) {
+	switch d := data.(type) {
+	case nil:
+		return http.StatusNoContent, nil
+	case response:
+		return d.status, d.body
+	case StatusCoder:
+		if isNil(d) {
+			return http.StatusNoContent, nil
+		}
+		return d.StatusCode(), d
+	}
+
+	return http.StatusOK, data
+}
+
+// bodyless reports whether a response with status carries no body, either because HTTP forbids one or
+// because there is nothing to encode.
+func bodyless(status int, data interface{}) bool {
+	return data == nil || status == http.StatusNoContent || status == http.StatusNotModified || (status >= 100 && status < 200)
+}
+
+// NoContent answers with a 204 and no body.
+func NoContent() interface{} {
+	return response{status: http.StatusNoContent}
+}
+
+// Redirect answers with a redirect to url, using code, which defaults to 302 Found when zero.
+func Redirect(url string, code int) interface{} {
+	if code == 0 {
+		code = http.StatusFound
+	}
+
+	return redirect{url: url, code: code}
+}
+
+// File answers with the file at path, supporting range and conditional requests. A filename sends it as a
+// download under that name, and an empty contentType is guessed from the extension or the content.
+func File(path, filename, contentType string) interface{} {
+	return file{path: path, filename: filename, contentType: contentType}
+}
+
+// FileReader answers with the content of r like File. Range and conditional requests are only supported
+// when r is an io.ReadSeeker, and r is closed if it is an io.Closer.
+func FileReader(r io.Reader, filename, contentType string) interface{} {
+	return file{reader: r, filename: filename, contentType: contentType}
+}
+
+// rawResponse is implemented by results that write themselves instead of being encoded.
+type rawResponse interface {
+	serve(w http.ResponseWriter, r *http.Request) error
+}
+
+type redirect struct {
+	url  string
+	code int
+}
+
+func (d redirect) serve(w http.ResponseWriter, r *http.Request) error {
+	if d.code < 300 || d.code > 399 {
+		return errors.E(errors.Invalid, errors.CodeServerError, fmt.Sprintf("invalid redirect status %d", d.code))
+	}
+
+	w.Header().Del("Content-Type")
+	http.Redirect(w, r, d.url, d.code)
+	return nil
+}
+
+type file struct {
+	path                  string
+	reader                io.Reader
+	filename, contentType string
+}
+
+func (f file) serve(w http.ResponseWriter, r *http.Request) error {
+	src, name, modtime := f.reader, f.filename, time.Time{}
+	if src == nil {
+		fd, err := os.Open(f.path)
+		if os.IsNotExist(err) {
+			return errors.E(errors.Invalid, errors.Code(http.StatusNotFound), "file not found")
+		}
+		if err != nil {
+			return errors.E(errors.IO, errors.CodeServerError, err)
+		}
+		defer fd.Close()
+
+		info, err := fd.Stat()
+		if err != nil {
+			return errors.E(errors.IO, errors.CodeServerError, err)
+		}
+		if info.IsDir() {
+			return errors.E(errors.Invalid, errors.Code(http.StatusNotFound), "file not found")
+		}
+
+		src, modtime = fd, info.ModTime()
+		if name == "" {
+			name = filepath.Base(f.path)
+		}
+	} else if c, ok := src.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	w.Header().Del("Content-Type")
+	if f.contentType != "" {
+		w.Header().Set("Content-Type", f.contentType)
+	}
+	if f.filename != "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": f.filename}))
+	}
+
+	if rs, ok := src.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, name, modtime, rs)
+		return nil
+	}
+
+	if f.contentType == "" {
+		if ct := mime.TypeByExtension(filepath.Ext(name)); ct != "" {
+			w.Header().Set("Content-Type", ct)
+		} else {
+			w.Header().Set("Content-Type", "application/octet-stream")
+		}
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		log.Printf("%+v", errors.E(errors.IO, errors.CodeServerError, err))
+	}
+
+	return nil
+}
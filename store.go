@@ -0,0 +1,211 @@
+package gomux
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hunterdishner/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// EmbeddedStore keeps the server's stateful features in a bbolt database file at path, for single instance
+// deployments without a Redis. The file is opened on the first Store call and closed once Serve has drained
+// its requests and stopped its workers; Cache uses it when its options name no Store. The file is locked by
+// the process holding it, so a Restart child waits for the parent to drain and release it, up to the drain
+// timeout and a second.
+func EmbeddedStore(path string) Option {
+	return func(s *Server) {
+		s.store = &embeddedStore{path: path}
+	}
+}
+
+type embeddedStore struct {
+	path string
+
+	once sync.Once
+	db   *bolt.DB
+	err  error
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// close closes the database if it was opened. Stores returned by Store fail afterwards.
+func (e *embeddedStore) close() {
+	if e == nil {
+		return
+	}
+
+	e.closeOnce.Do(func() {
+		// Running once keeps Store from opening the database after it was closed.
+		e.once.Do(func() { e.err = errors.E(errors.IO, errors.CodeServerError, "embedded store is closed") })
+		if e.db == nil {
+			return
+		}
+
+		close(e.done)
+		if err := e.db.Close(); err != nil {
+			log.Printf("%+v", errors.E(errors.IO, errors.CodeServerError, err))
+		}
+	})
+}
+
+// Store returns the bucket of the embedded store with the given name, opening the database if it is not yet.
+// Each feature should use its own bucket so their keys cannot collide.
+func (s *Server) Store(bucket string) (*BoltStore, error) {
+	if s.store == nil {
+		return nil, errors.E(errors.Invalid, errors.CodeServerError, "no embedded store configured")
+	}
+
+	s.store.once.Do(func() {
+		db, err := bolt.Open(s.store.path, 0o600, &bolt.Options{Timeout: s.drain.longest() + time.Second})
+		if err != nil {
+			s.store.err = errors.E(errors.IO, errors.CodeServerError, err)
+			return
+		}
+		s.store.db, s.store.done = db, make(chan struct{})
+
+		go func(done <-chan struct{}) {
+			ticker := time.NewTicker(time.Minute)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					if err := purgeExpired(db); err != nil {
+						log.Printf("%+v", errors.E(errors.IO, errors.CodeServerError, err))
+					}
+				}
+			}
+		}(s.store.done)
+	})
+	if s.store.err != nil {
+		return nil, s.store.err
+	}
+
+	if err := s.store.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		return err
+	}); err != nil {
+		return nil, errors.E(errors.IO, errors.CodeServerError, err)
+	}
+
+	return &BoltStore{db: s.store.db, bucket: []byte(bucket)}, nil
+}
+
+// BoltStore is a CacheStore kept in a bucket of a bbolt database. Expired entries are skipped on reads and
+// deleted every minute.
+type BoltStore struct {
+	db     *bolt.DB
+	bucket []byte
+}
+
+// Entries are stored as the expiry in Unix nanoseconds, big endian, followed by the value.
+const boltExpiryLen = 8
+
+func (b *BoltStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	var value []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(b.bucket).Get([]byte(key))
+		if len(v) < boltExpiryLen || expired(v) {
+			return nil
+		}
+		value = append([]byte(nil), v[boltExpiryLen:]...)
+		return nil
+	})
+	if err != nil {
+		return nil, false, errors.E(errors.IO, errors.CodeServerError, err)
+	}
+
+	return value, value != nil, nil
+}
+
+func (b *BoltStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	entry := make([]byte, boltExpiryLen+len(value))
+	binary.BigEndian.PutUint64(entry, uint64(time.Now().Add(ttl).UnixNano()))
+	copy(entry[boltExpiryLen:], value)
+
+	if err := b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(b.bucket).Put([]byte(key), entry)
+	}); err != nil {
+		return errors.E(errors.IO, errors.CodeServerError, err)
+	}
+
+	return nil
+}
+
+func (b *BoltStore) DeletePrefix(ctx context.Context, prefix string) error {
+	if err := b.db.Update(func(tx *bolt.Tx) error {
+		// Deleting through the cursor would skip the key after each deleted one.
+		var keys [][]byte
+		c := tx.Bucket(b.bucket).Cursor()
+		for k, _ := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, _ = c.Next() {
+			keys = append(keys, append([]byte(nil), k...))
+		}
+
+		bucket := tx.Bucket(b.bucket)
+		for _, k := range keys {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return errors.E(errors.IO, errors.CodeServerError, err)
+	}
+
+	return nil
+}
+
+// scan calls fn with the value of every unexpired key starting with prefix, in key order.
+func (b *BoltStore) scan(prefix string, fn func(value []byte) error) error {
+	if err := b.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(b.bucket).Cursor()
+		for k, v := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, v = c.Next() {
+			if len(v) < boltExpiryLen || expired(v) {
+				continue
+			}
+			if err := fn(v[boltExpiryLen:]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return errors.E(errors.IO, errors.CodeServerError, err)
+	}
+
+	return nil
+}
+
+func expired(entry []byte) bool {
+	return time.Now().UnixNano() > int64(binary.BigEndian.Uint64(entry))
+}
+
+// purgeExpired deletes the expired entries of every bucket.
+func purgeExpired(db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+			var keys [][]byte
+			if err := bucket.ForEach(func(k, v []byte) error {
+				if len(v) >= boltExpiryLen && expired(v) {
+					keys = append(keys, append([]byte(nil), k...))
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+
+			for _, k := range keys {
+				if err := bucket.Delete(k); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
@@ -0,0 +1,176 @@
+package gomux
+
+import (
+	"bufio"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/hunterdishner/errors"
+)
+
+// Stream formats.
+const (
+	// StreamNDJSON writes one JSON document per line as application/x-ndjson.
+	StreamNDJSON = "ndjson"
+	// StreamJSONArray writes the items as the elements of one JSON array.
+	StreamJSONArray = "array"
+)
+
+// StreamOptions configures StreamWith. Zero values fall back to the defaults noted on each field.
+type StreamOptions struct {
+	// Format forces StreamNDJSON or StreamJSONArray. Defaults to NDJSON when the Accept header asks for
+	// application/x-ndjson or application/jsonl, else a JSON array.
+	Format string
+	// FlushEvery flushes the response after this many items. Defaults to 100.
+	FlushEvery int
+	// FlushInterval flushes the response when this long has passed since the last flush, checked as items
+	// arrive. Defaults to a second.
+	FlushInterval time.Duration
+}
+
+// Stream answers with the items next yields, encoded one at a time so large results, e.g. exports, are never
+// held in memory:
+//
+//	rows, err := db.QueryContext(r.Context(), "SELECT id, name FROM users")
+//	...
+//	return gomux.Stream(func() (interface{}, bool, error) {
+//		if !rows.Next() {
+//			return nil, false, rows.Err()
+//		}
+//		var u User
+//		return u, true, rows.Scan(&u.ID, &u.Name)
+//	}), nil
+//
+// next reports false once there are no more items. Flushes go through http.ResponseController, so compression
+// middleware whose writer flushes, or unwraps to one that does, sends each batch as it is written. An error
+// before the first item is answered like a handler error; later, the response is aborted so clients do not
+// mistake a truncated stream for a complete one.
+func Stream(next func() (interface{}, bool, error)) interface{} {
+	return StreamWith(StreamOptions{}, next)
+}
+
+// StreamWith is Stream with options.
+func StreamWith(opts StreamOptions, next func() (interface{}, bool, error)) interface{} {
+	if opts.FlushEvery <= 0 {
+		opts.FlushEvery = 100
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+
+	return stream{opts: opts, next: next}
+}
+
+// ChannelItems adapts a channel of any element type to the next function of Stream, yielding its values until
+// it is closed. The producer should stop, and close the channel, once the request context is done.
+func ChannelItems(ch interface{}) func() (interface{}, bool, error) {
+	v := reflect.ValueOf(ch)
+	if v.Kind() != reflect.Chan || v.Type().ChanDir()&reflect.RecvDir == 0 {
+		err := errors.E(errors.Invalid, errors.CodeServerError, fmt.Sprintf("ChannelItems needs a receivable channel, not %T", ch))
+		return func() (interface{}, bool, error) { return nil, false, err }
+	}
+
+	return func() (interface{}, bool, error) {
+		item, ok := v.Recv()
+		if !ok {
+			return nil, false, nil
+		}
+		return item.Interface(), true, nil
+	}
+}
+
+type stream struct {
+	opts StreamOptions
+	next func() (interface{}, bool, error)
+}
+
+func (s stream) serve(w http.ResponseWriter, r *http.Request) error {
+	format := s.opts.Format
+	if format == "" {
+		format = StreamJSONArray
+		accept := r.Header.Get("Accept")
+		if strings.Contains(accept, "application/x-ndjson") || strings.Contains(accept, "application/jsonl") {
+			format = StreamNDJSON
+		}
+		w.Header().Add("Vary", "Accept")
+	}
+
+	item, ok, err := s.next()
+	if err != nil {
+		return err
+	}
+
+	if format == StreamNDJSON {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	bw := bufio.NewWriterSize(w, 32<<10)
+	enc := json.NewEncoder(bw)
+	flush := func() error {
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		if err := rc.Flush(); err != nil && !stderrors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		return nil
+	}
+
+	if format == StreamJSONArray {
+		bw.WriteByte('[')
+	}
+
+	count, lastFlush := 0, time.Now()
+	for ok {
+		if r.Context().Err() != nil {
+			// The client is gone; there is no one to tell.
+			return nil
+		}
+
+		if format == StreamJSONArray && count > 0 {
+			bw.WriteByte(',')
+		}
+		if err = enc.Encode(item); err != nil {
+			err = errors.E(errors.Encoding, errors.CodeServerError, err)
+			break
+		}
+		count++
+
+		if count%s.opts.FlushEvery == 0 || time.Since(lastFlush) >= s.opts.FlushInterval {
+			if err = flush(); err != nil {
+				err = errors.E(errors.IO, errors.CodeServerError, err)
+				break
+			}
+			lastFlush = time.Now()
+		}
+
+		if item, ok, err = s.next(); err != nil {
+			break
+		}
+	}
+
+	if err != nil {
+		log.Printf("%+v", errors.E(errors.IO, errors.CodeServerError, fmt.Sprintf("stream of %s aborted after %d items: %v", r.URL.Path, count, err)))
+		// Aborting resets the stream instead of ending it cleanly, so the client sees it is incomplete.
+		panic(http.ErrAbortHandler)
+	}
+
+	if format == StreamJSONArray {
+		bw.WriteString("]\n")
+	}
+	if err := flush(); err != nil {
+		log.Printf("%+v", errors.E(errors.IO, errors.CodeServerError, err))
+	}
+
+	return nil
+}
@@ -0,0 +1,371 @@
+package gomux
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hunterdishner/errors"
+)
+
+const strictMaxLine = 64 << 10
+
+// StrictParsing rejects HTTP/1 requests that proxies in front of the server could frame differently than it
+// does, the vectors used for request smuggling: a Content-Length alongside Transfer-Encoding, conflicting
+// Content-Lengths, a Transfer-Encoding not ending in chunked, absolute-form targets, obsolete line folding,
+// whitespace before a header colon and lines not ended by CRLF. net/http resolves most of these silently, so
+// the checks run on the raw connection; a rejected request is answered with a 400, logged and its connection
+// closed. Connections upgraded with a 101 response are not inspected past their handshake.
+//
+// With TLS, strict parsing also terminates TLS itself and only offers HTTP/1.1 through ALPN.
+func StrictParsing() Option {
+	return func(s *Server) {
+		s.strict = true
+	}
+}
+
+type tlsConnKey struct{}
+
+// strictListener wraps ln so every connection it accepts is inspected, terminating TLS underneath when it is
+// enabled. srv is set up to restore Request.TLS, which net/http only fills in for the connections it
+// terminates itself.
+func (s *Server) strictListener(srv *http.Server, ln net.Listener) (net.Listener, error) {
+	if s.tls {
+		cfg, err := s.serverTLSConfig()
+		if err != nil {
+			ln.Close()
+			return nil, err
+		}
+		cfg.NextProtos = []string{"http/1.1"}
+
+		ln = tls.NewListener(ln, cfg)
+
+		srv.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+			if sc, ok := c.(*strictConn); ok {
+				if tc, ok := sc.Conn.(*tls.Conn); ok {
+					return context.WithValue(ctx, tlsConnKey{}, tc)
+				}
+			}
+			return ctx
+		}
+
+		next := srv.Handler
+		srv.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tc, ok := r.Context().Value(tlsConnKey{}).(*tls.Conn); ok && r.TLS == nil {
+				state := tc.ConnectionState()
+				r.TLS = &state
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	return strictListener{Listener: ln}, nil
+}
+
+type strictListener struct {
+	net.Listener
+}
+
+func (l strictListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return &strictConn{Conn: c}, nil
+}
+
+// strictConn runs everything read from the connection through a parser that follows the request framing.
+type strictConn struct {
+	net.Conn
+	// mu guards parser, which background reads and responses written by a handler both reach.
+	mu     sync.Mutex
+	parser strictParser
+
+	once     sync.Once
+	rejected error
+}
+
+func (c *strictConn) Read(b []byte) (int, error) {
+	if c.rejected != nil {
+		return 0, c.rejected
+	}
+
+	n, err := c.Conn.Read(b)
+	c.mu.Lock()
+	perr := c.parser.feed(b[:n])
+	c.mu.Unlock()
+	if perr != nil {
+		c.reject(perr)
+		return 0, c.rejected
+	}
+
+	return n, err
+}
+
+func (c *strictConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	c.parser.response(b)
+	c.mu.Unlock()
+
+	return c.Conn.Write(b)
+}
+
+// reject answers the connection with a 400 and fails its reads. The failure is reported as a read error so
+// net/http closes the connection without writing a response of its own.
+func (c *strictConn) reject(reason error) {
+	c.once.Do(func() {
+		err := errors.E(errors.Invalid, errors.CodeBadRequest, fmt.Sprintf("rejected request from %s: %v", c.RemoteAddr(), reason))
+		log.Printf("%+v", err)
+
+		e, ok := err.(*errors.Error)
+		if !ok {
+			e = &errors.Error{Code: errors.CodeBadRequest}
+		}
+
+		var body bytes.Buffer
+		if err := defaultEncoder.EncodeError(&body, e); err != nil {
+			log.Printf("%+v", errors.E(errors.Encoding, errors.CodeServerError, err))
+		}
+
+		fmt.Fprintf(c.Conn, "HTTP/1.1 400 Bad Request\r\nContent-Type: %s\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s",
+			defaultEncoder.ContentType(), body.Len(), body.Bytes())
+
+		c.rejected = &net.OpError{Op: "read", Net: "tcp", Addr: c.RemoteAddr(), Err: reason}
+	})
+}
+
+const (
+	stateHead = iota
+	stateBody
+	stateChunkSize
+	stateChunkData
+	stateChunkEnd
+	stateTrailer
+	statePassthrough
+)
+
+// strictParser follows HTTP/1 request framing across reads: the head line by line, then a body of
+// Content-Length bytes or chunks up to the trailer.
+type strictParser struct {
+	state     int
+	line      []byte
+	remaining int64
+
+	started   bool
+	lengths   []string
+	encodings []string
+	upgrade   bool
+	// upgrading is set from the end of a head asking for an upgrade until a final response to it is written.
+	upgrading bool
+}
+
+func (p *strictParser) feed(b []byte) error {
+	for len(b) > 0 {
+		switch p.state {
+		case statePassthrough:
+			return nil
+		case stateBody, stateChunkData:
+			n := int64(len(b))
+			if n > p.remaining {
+				n = p.remaining
+			}
+			b, p.remaining = b[n:], p.remaining-n
+
+			if p.remaining == 0 {
+				if p.state == stateBody {
+					p.state = stateHead
+				} else {
+					p.state, p.remaining = stateChunkEnd, 2
+				}
+			}
+		case stateChunkEnd:
+			if b[0] != "\r\n"[2-p.remaining] {
+				return fmt.Errorf("chunk data not followed by CRLF")
+			}
+			b, p.remaining = b[1:], p.remaining-1
+
+			if p.remaining == 0 {
+				p.state = stateChunkSize
+			}
+		default:
+			i := bytes.IndexByte(b, '\n')
+			if i < 0 {
+				i = len(b) - 1
+			}
+			if len(p.line)+i+1 > strictMaxLine {
+				return fmt.Errorf("line longer than %d bytes", strictMaxLine)
+			}
+
+			p.line = append(p.line, b[:i+1]...)
+			b = b[i+1:]
+			if p.line[len(p.line)-1] != '\n' {
+				continue
+			}
+
+			line := p.line
+			p.line = p.line[:0]
+			if len(line) < 2 || line[len(line)-2] != '\r' {
+				return fmt.Errorf("line not ended by CRLF")
+			}
+			if err := p.onLine(line[:len(line)-2]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// response stops inspecting the connection once a request asking for an upgrade is answered with a 101. Any
+// other final response leaves the connection to be parsed as HTTP.
+func (p *strictParser) response(b []byte) {
+	if !p.upgrading || !bytes.HasPrefix(b, []byte("HTTP/1.")) || len(b) < 12 {
+		return
+	}
+
+	switch status := string(b[9:12]); {
+	case status == "101":
+		p.state, p.upgrading = statePassthrough, false
+	case status[0] != '1':
+		p.upgrading = false
+	}
+}
+
+func (p *strictParser) onLine(line []byte) error {
+	if bytes.IndexByte(line, '\r') >= 0 {
+		return fmt.Errorf("bare CR in line")
+	}
+
+	switch p.state {
+	case stateHead:
+		if !p.started {
+			// Empty lines ahead of the request line are allowed.
+			if len(line) == 0 {
+				return nil
+			}
+			return p.requestLine(string(line))
+		}
+		if len(line) == 0 {
+			return p.endHead()
+		}
+		return p.header(string(line))
+	case stateChunkSize:
+		size, _, _ := strings.Cut(string(line), ";")
+		n, err := strconv.ParseUint(size, 16, 63)
+		if err != nil {
+			return fmt.Errorf("invalid chunk size %q", size)
+		}
+
+		if n == 0 {
+			p.state = stateTrailer
+		} else {
+			p.state, p.remaining = stateChunkData, int64(n)
+		}
+	case stateTrailer:
+		if len(line) == 0 {
+			p.state = stateHead
+			return nil
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			return fmt.Errorf("obsolete line folding")
+		}
+	}
+
+	return nil
+}
+
+func (p *strictParser) requestLine(line string) error {
+	// The HTTP/2 connection preface, sent by prior knowledge clients.
+	if line == "PRI * HTTP/2.0" {
+		p.state = statePassthrough
+		return nil
+	}
+
+	parts := strings.Split(line, " ")
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed request line")
+	}
+
+	target := strings.ToLower(parts[1])
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		return fmt.Errorf("absolute-form request target")
+	}
+
+	p.started = true
+	return nil
+}
+
+func (p *strictParser) header(line string) error {
+	if line[0] == ' ' || line[0] == '\t' {
+		return fmt.Errorf("obsolete line folding")
+	}
+
+	name, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return fmt.Errorf("malformed header line")
+	}
+	if strings.ContainsAny(name, " \t") {
+		return fmt.Errorf("whitespace in header name %q", name)
+	}
+
+	switch http.CanonicalHeaderKey(name) {
+	case "Content-Length":
+		for _, v := range strings.Split(value, ",") {
+			p.lengths = append(p.lengths, strings.TrimSpace(v))
+		}
+	case "Transfer-Encoding":
+		for _, v := range strings.Split(value, ",") {
+			p.encodings = append(p.encodings, strings.ToLower(strings.TrimSpace(v)))
+		}
+	case "Connection":
+		for _, v := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), "upgrade") {
+				p.upgrade = true
+			}
+		}
+	}
+
+	return nil
+}
+
+// endHead checks the framing headers of the request and moves on to its body.
+func (p *strictParser) endHead() error {
+	lengths, encodings, upgrade := p.lengths, p.encodings, p.upgrade
+	p.started, p.lengths, p.encodings, p.upgrade = false, nil, nil, false
+
+	if len(encodings) > 0 && len(lengths) > 0 {
+		return fmt.Errorf("both Content-Length and Transfer-Encoding")
+	}
+	if len(encodings) > 0 && encodings[len(encodings)-1] != "chunked" {
+		return fmt.Errorf("Transfer-Encoding %q does not end in chunked", strings.Join(encodings, ", "))
+	}
+	for _, l := range lengths {
+		if l != lengths[0] {
+			return fmt.Errorf("conflicting Content-Length headers")
+		}
+	}
+
+	p.upgrading = upgrade
+	switch {
+	case len(encodings) > 0:
+		p.state = stateChunkSize
+	case len(lengths) > 0:
+		n, err := strconv.ParseUint(lengths[0], 10, 63)
+		if err != nil {
+			return fmt.Errorf("invalid Content-Length %q", lengths[0])
+		}
+		if n > 0 {
+			p.state, p.remaining = stateBody, int64(n)
+		}
+	}
+
+	return nil
+}
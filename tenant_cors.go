@@ -0,0 +1,83 @@
+package gomux
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hunterdishner/errors"
+)
+
+// TenantOriginsOptions resolves the CORS origins allowed for each API key or tenant.
+type TenantOriginsOptions struct {
+	// Key extracts the API key or tenant of a request. Browsers send preflights without credentials or custom
+	// headers, so it should read the path, query or Host rather than an Authorization or API key header.
+	Key func(r *http.Request) string
+	// Origins returns the origins allowed for key. Like AllowedOrigins they may contain a single * wildcard.
+	Origins func(ctx context.Context, key string) ([]string, error)
+	// TTL is how long resolved origins are cached. Defaults to 5 minutes.
+	TTL time.Duration
+	// MaxKeys caps the number of keys cached. Defaults to 10000.
+	MaxKeys int
+}
+
+// TenantOrigins allows each API key or tenant the origins its provider returns, so every customer's web app can
+// call the service without a wildcard policy. It replaces AllowedOrigins in the default CORS handling and is
+// ignored when CustomCors is used. A request without a key, or whose provider fails, is not allowed.
+func TenantOrigins(opts TenantOriginsOptions) Option {
+	if opts.TTL == 0 {
+		opts.TTL = 5 * time.Minute
+	}
+	if opts.MaxKeys == 0 {
+		opts.MaxKeys = 10000
+	}
+
+	cache := NewMemoryCache(opts.MaxKeys)
+
+	return func(s *Server) {
+		s.corsOptions.AllowedOrigins = nil
+		s.corsOptions.AllowOriginRequestFunc = func(r *http.Request, origin string) bool {
+			key := opts.Key(r)
+			if key == "" {
+				return false
+			}
+
+			var origins []string
+			if b, ok, _ := cache.Get(r.Context(), key); ok {
+				origins = strings.Split(string(b), "\n")
+			} else {
+				var err error
+				if origins, err = opts.Origins(r.Context(), key); err != nil {
+					log.Printf("%+v", errors.E(errors.IO, errors.CodeServerError, err))
+					return false
+				}
+				cache.Set(r.Context(), key, []byte(strings.Join(origins, "\n")), opts.TTL)
+			}
+
+			for _, allowed := range origins {
+				if originMatches(allowed, origin) {
+					return true
+				}
+			}
+
+			return false
+		}
+	}
+}
+
+// originMatches reports whether origin matches pattern, which may contain a single * wildcard.
+func originMatches(pattern, origin string) bool {
+	pattern, origin = strings.ToLower(pattern), strings.ToLower(origin)
+	if pattern == "*" {
+		return true
+	}
+
+	prefix, suffix, wildcard := strings.Cut(pattern, "*")
+	if !wildcard {
+		return pattern == origin
+	}
+
+	return len(origin) >= len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix)
+}
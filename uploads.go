@@ -0,0 +1,289 @@
+package gomux
+
+import (
+	"bufio"
+	"context"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/hunterdishner/errors"
+)
+
+// UploadOptions configures what ReceiveUpload accepts on a route. Zero values fall back to the defaults noted
+// on each field.
+type UploadOptions struct {
+	// MaxFileBytes caps the size of each file. Defaults to 32MB.
+	MaxFileBytes int64
+	// MaxFiles caps the number of files in a request. Defaults to 10.
+	MaxFiles int
+	// AllowedTypes lists the accepted media types, e.g. "image/png" or "image/*". Empty accepts any. The type is
+	// sniffed from the first 512 bytes with http.DetectContentType rather than taken from the client, except for
+	// plain text, which sniffing cannot tell apart from JSON or CSV, so the declared type is checked for it.
+	AllowedTypes []string
+	// Store receives the content of each file. Defaults to TempDirStore("").
+	Store UploadStore
+}
+
+// UploadedFile describes a file received by ReceiveUpload.
+type UploadedFile struct {
+	// Field is the form field the file was sent in.
+	Field    string
+	Filename string
+	// ContentType is the media type the client declared, or the sniffed one when it declared none or
+	// application/octet-stream.
+	ContentType string
+	Size        int64
+	// Location is where the Store put the file, e.g. its path on disk.
+	Location string
+}
+
+// UploadStore saves uploaded files. Save must consume content and stop, removing anything it wrote, when
+// reading it fails.
+type UploadStore interface {
+	Save(ctx context.Context, file UploadedFile, content io.Reader) (location string, err error)
+}
+
+// UploadStoreFunc adapts a function, e.g. a write to object storage, to an UploadStore.
+type UploadStoreFunc func(ctx context.Context, file UploadedFile, content io.Reader) (string, error)
+
+func (f UploadStoreFunc) Save(ctx context.Context, file UploadedFile, content io.Reader) (string, error) {
+	return f(ctx, file, content)
+}
+
+// TempDirStore saves each file in a new temporary file in dir, or the default temporary directory when dir is
+// empty, and reports its path as the location. Handlers own the files and must move or remove them.
+func TempDirStore(dir string) UploadStore {
+	return UploadStoreFunc(func(ctx context.Context, file UploadedFile, content io.Reader) (string, error) {
+		f, err := os.CreateTemp(dir, "upload-*"+path.Ext(file.Filename))
+		if err != nil {
+			return "", err
+		}
+
+		if _, err := io.Copy(f, content); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return "", err
+		}
+
+		if err := f.Close(); err != nil {
+			os.Remove(f.Name())
+			return "", err
+		}
+
+		return f.Name(), nil
+	})
+}
+
+// WriterStore streams each file to the writer open returns, closing it afterwards if it is an io.Closer.
+func WriterStore(open func(file UploadedFile) (io.Writer, error)) UploadStore {
+	return UploadStoreFunc(func(ctx context.Context, file UploadedFile, content io.Reader) (string, error) {
+		w, err := open(file)
+		if err != nil {
+			return "", err
+		}
+
+		_, err = io.Copy(w, content)
+		if c, ok := w.(io.Closer); ok {
+			if closeErr := c.Close(); err == nil {
+				err = closeErr
+			}
+		}
+
+		return "", err
+	})
+}
+
+// Uploads sets the upload options of each of the given routes.
+func Uploads(opts UploadOptions, routes ...Route) []Route {
+	for i := range routes {
+		routes[i].Upload = &opts
+	}
+
+	return routes
+}
+
+// Upload is a received multipart/form-data request.
+type Upload struct {
+	Fields url.Values
+	Files  []UploadedFile
+}
+
+// File returns the first file sent in field.
+func (u *Upload) File(field string) (UploadedFile, bool) {
+	for _, f := range u.Files {
+		if f.Field == field {
+			return f, true
+		}
+	}
+
+	return UploadedFile{}, false
+}
+
+type uploadKey struct{}
+
+// maxUploadFieldBytes caps the combined size of the non-file fields, like http.Request.ParseMultipartForm.
+const maxUploadFieldBytes = 10 << 20
+
+var errFileTooLarge = stderrors.New("file too large")
+
+// withUpload makes the route's upload options available to ReceiveUpload.
+func withUpload(opts *UploadOptions, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), uploadKey{}, opts)))
+	})
+}
+
+// ReceiveUpload streams the parts of a multipart/form-data request to the route's UploadOptions store as they
+// arrive, enforcing its limits, and returns the fields and files. Afterwards Bind reads form sources from the
+// received fields. Files that do not fit the limits are answered with a 413 or 415; files stored before a
+// failure are not removed.
+func ReceiveUpload(r *http.Request) (*Upload, error) {
+	opts, _ := r.Context().Value(uploadKey{}).(*UploadOptions)
+	if opts == nil {
+		opts = &UploadOptions{}
+	}
+	maxBytes, maxFiles, store := opts.MaxFileBytes, opts.MaxFiles, opts.Store
+	if maxBytes == 0 {
+		maxBytes = 32 << 20
+	}
+	if maxFiles == 0 {
+		maxFiles = 10
+	}
+	if store == nil {
+		store = TempDirStore("")
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, errors.E(errors.Encoding, errors.CodeBadRequest, err)
+	}
+
+	upload := &Upload{Fields: url.Values{}}
+	fieldBytes := int64(0)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return upload, uploadError(err)
+		}
+
+		if part.FileName() == "" {
+			b, err := io.ReadAll(io.LimitReader(part, maxUploadFieldBytes-fieldBytes+1))
+			if err != nil {
+				return upload, uploadError(err)
+			}
+			if fieldBytes += int64(len(b)); fieldBytes > maxUploadFieldBytes {
+				return upload, errors.E(errors.Invalid, errors.Code(http.StatusRequestEntityTooLarge), "form fields too large")
+			}
+			upload.Fields.Add(part.FormName(), string(b))
+			continue
+		}
+
+		if len(upload.Files) == maxFiles {
+			return upload, errors.E(errors.Invalid, errors.Code(http.StatusRequestEntityTooLarge), fmt.Sprintf("more than %d files", maxFiles))
+		}
+
+		file, err := receiveFile(r.Context(), part, maxBytes, opts.AllowedTypes, store)
+		if err != nil {
+			return upload, err
+		}
+		upload.Files = append(upload.Files, file)
+	}
+
+	r.PostForm, r.Form = upload.Fields, url.Values{}
+	for k, v := range upload.Fields {
+		r.Form[k] = append([]string(nil), v...)
+	}
+	for k, v := range r.URL.Query() {
+		r.Form[k] = append(r.Form[k], v...)
+	}
+	r.MultipartForm = &multipart.Form{Value: upload.Fields}
+
+	return upload, nil
+}
+
+func receiveFile(ctx context.Context, part *multipart.Part, maxBytes int64, allowed []string, store UploadStore) (UploadedFile, error) {
+	file := UploadedFile{Field: part.FormName(), Filename: path.Base(strings.ReplaceAll(part.FileName(), `\`, "/"))}
+
+	content := bufio.NewReaderSize(part, 512)
+	file.ContentType, _, _ = mime.ParseMediaType(part.Header.Get("Content-Type"))
+	declared := file.ContentType
+	if declared == "" || declared == "application/octet-stream" || len(allowed) > 0 {
+		head, err := content.Peek(512)
+		if err != nil && err != io.EOF {
+			return file, uploadError(err)
+		}
+		sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+		if sniffed != "text/plain" || declared == "" || declared == "application/octet-stream" {
+			file.ContentType = sniffed
+		}
+	}
+
+	if !typeAllowed(allowed, file.ContentType) {
+		return file, errors.E(errors.Invalid, errors.Code(http.StatusUnsupportedMediaType), fmt.Sprintf("%s: type %s is not allowed", file.Filename, file.ContentType))
+	}
+
+	limited := &limitedReader{r: content, remaining: maxBytes}
+	location, err := store.Save(ctx, file, limited)
+	file.Size = maxBytes - limited.remaining
+	if stderrors.Is(err, errFileTooLarge) {
+		return file, errors.E(errors.Invalid, errors.Code(http.StatusRequestEntityTooLarge), fmt.Sprintf("%s exceeds %d bytes", file.Filename, maxBytes))
+	}
+	if err != nil {
+		if bodyErr := bodyError(err); bodyErr != nil {
+			return file, bodyErr
+		}
+		return file, errors.E(errors.IO, errors.CodeServerError, err)
+	}
+	file.Location = location
+
+	return file, nil
+}
+
+func typeAllowed(allowed []string, mediatype string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	for _, a := range allowed {
+		if prefix, ok := strings.CutSuffix(a, "/*"); ok && strings.HasPrefix(mediatype, prefix+"/") || a == mediatype {
+			return true
+		}
+	}
+
+	return false
+}
+
+func uploadError(err error) error {
+	if bodyErr := bodyError(err); bodyErr != nil {
+		return bodyErr
+	}
+
+	return errors.E(errors.Encoding, errors.CodeBadRequest, err)
+}
+
+// limitedReader fails with errFileTooLarge instead of ending the file early once more than remaining bytes
+// are read.
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	if l.remaining -= int64(n); l.remaining < 0 {
+		return n, errFileTooLarge
+	}
+
+	return n, err
+}
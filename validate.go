@@ -0,0 +1,285 @@
+package gomux
+
+import (
+	"fmt"
+	"io"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/hunterdishner/errors"
+)
+
+// FieldError is a validation failure of one field.
+type FieldError struct {
+	// Field is the path of the field in the request, using JSON names, e.g. "items[2].sku".
+	Field string `json:"field"`
+	// Rule is the failed rule, e.g. "required" or "max".
+	Rule string `json:"rule"`
+	// Param is the parameter of the rule, e.g. the 50 of max=50.
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every field that failed validation. Handlers returning it answer with a 400 carrying
+// the field errors; encoders render them through FieldErrorEncoder when they implement it.
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		msgs = append(msgs, f.Field+": "+f.Message)
+	}
+
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+// FieldErrorEncoder is implemented by encoders that render validation failures field by field. Others render
+// them through EncodeError.
+type FieldErrorEncoder interface {
+	EncodeFieldErrors(w io.Writer, err *ValidationError) error
+}
+
+func (jsonEncoder) EncodeFieldErrors(w io.Writer, err *ValidationError) error {
+	return encodeJSON(w, struct {
+		Code   int          `json:"code"`
+		Fields []FieldError `json:"fields"`
+	}{400, err.Fields})
+}
+
+// Validator is implemented by request types with checks the validate tag cannot express. Validate runs after the
+// tag rules pass; errors other than a ValidationError or an errors.Error are answered with a 400.
+type Validator interface {
+	Validate() error
+}
+
+// ValidationRule reports whether v satisfies a rule given its parameter.
+type ValidationRule func(v reflect.Value, param string) bool
+
+var validationRules = struct {
+	sync.RWMutex
+	m map[string]ValidationRule
+}{m: map[string]ValidationRule{}}
+
+// RegisterValidation adds a rule the validate tag can name, e.g.
+// gomux.RegisterValidation("sku", func(v reflect.Value, _ string) bool { return skuPattern.MatchString(v.String()) }).
+func RegisterValidation(name string, fn ValidationRule) {
+	validationRules.Lock()
+	defer validationRules.Unlock()
+	validationRules.m[name] = fn
+}
+
+// Validate checks v, a struct or a pointer to one, against the validate tags of its fields:
+//
+//	type User struct {
+//		Name  string   `json:"name" validate:"required,max=50"`
+//		Email string   `json:"email" validate:"required,email"`
+//		Role  string   `json:"role" validate:"oneof=admin member"`
+//		Tags  []string `json:"tags" validate:"max=10"`
+//	}
+//
+// The rules are required (not the zero value), min, max and len (the length of strings, slices and maps, the
+// value of numbers), oneof (space separated values), email, url and any registered with RegisterValidation.
+// Rules other than required skip zero values. Nested structs, and the structs in slices and maps, are validated
+// too. Bind validates what it binds, so handlers only see valid requests. Every failure is collected into a
+// ValidationError. Tags naming an unknown rule, or a rule with a bad parameter or on a field it does not apply
+// to, are mistakes in the code rather than the request and fail with a 500 instead.
+func Validate(v interface{}) error {
+	var errs []FieldError
+	var tagErrs []string
+	validateValue(reflect.ValueOf(v), "", &errs, &tagErrs)
+	if len(tagErrs) > 0 {
+		return errors.E(errors.Invalid, errors.CodeServerError, fmt.Sprintf("invalid validate tags: %s", strings.Join(tagErrs, "; ")))
+	}
+	if len(errs) > 0 {
+		return &ValidationError{Fields: errs}
+	}
+
+	if val, ok := v.(Validator); ok {
+		if err := val.Validate(); err != nil {
+			switch err.(type) {
+			case *ValidationError, *errors.Error:
+				return err
+			}
+			return errors.E(errors.Invalid, errors.CodeBadRequest, err)
+		}
+	}
+
+	return nil
+}
+
+func validateValue(v reflect.Value, path string, errs *[]FieldError, tagErrs *[]string) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if sf.PkgPath != "" {
+				continue
+			}
+
+			name := fieldName(sf)
+			if name == "-" {
+				continue
+			}
+			fieldPath := name
+			if path != "" {
+				fieldPath = path + "." + name
+			}
+			// Embedded structs without a JSON name have their fields promoted, as encoding/json does.
+			if sf.Anonymous && sf.Tag.Get("json") == "" {
+				fieldPath = path
+			}
+
+			if tag, ok := sf.Tag.Lookup("validate"); ok {
+				validateRules(v.Field(i), fieldPath, tag, errs, tagErrs)
+			}
+			validateValue(v.Field(i), fieldPath, errs, tagErrs)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			validateValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), errs, tagErrs)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			validateValue(iter.Value(), fmt.Sprintf("%s[%v]", path, iter.Key()), errs, tagErrs)
+		}
+	}
+}
+
+// fieldName is the name a field has in requests: its JSON name, else its in tag key, else its Go name.
+func fieldName(sf reflect.StructField) string {
+	if name, _, _ := strings.Cut(sf.Tag.Get("json"), ","); name != "" {
+		return name
+	}
+	if in := sf.Tag.Get("in"); in != "" {
+		if _, key, _ := strings.Cut(strings.Split(in, ",")[0], "="); key != "" {
+			return key
+		}
+	}
+
+	return sf.Name
+}
+
+func validateRules(v reflect.Value, path, tag string, errs *[]FieldError, tagErrs *[]string) {
+	for _, rule := range strings.Split(tag, ",") {
+		if rule = strings.TrimSpace(rule); rule == "" {
+			continue
+		}
+		name, param, _ := strings.Cut(rule, "=")
+
+		if name == "required" {
+			if v.IsZero() {
+				*errs = append(*errs, FieldError{Field: path, Rule: name, Message: "is required"})
+				return
+			}
+			continue
+		}
+		if v.IsZero() {
+			continue
+		}
+
+		msg, ok, err := checkRule(v, name, param)
+		if err != nil {
+			*tagErrs = append(*tagErrs, fmt.Sprintf("%s: %v", path, err))
+			continue
+		}
+		if !ok {
+			*errs = append(*errs, FieldError{Field: path, Rule: name, Param: param, Message: msg})
+		}
+	}
+}
+
+// checkRule applies a rule other than required to a non-zero value, describing the failure when it fails. The
+// error reports a rule that cannot be applied at all.
+func checkRule(v reflect.Value, name, param string) (string, bool, error) {
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	switch name {
+	case "min", "max", "len":
+		limit, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return "", false, fmt.Errorf("rule %s has invalid parameter %q", name, param)
+		}
+		n, unit, ok := measure(v)
+		if !ok {
+			return "", false, fmt.Errorf("rule %s does not apply to %s", name, v.Kind())
+		}
+		switch {
+		case name == "min" && n < limit:
+			return fmt.Sprintf("must be at least %s%s", param, unit), false, nil
+		case name == "max" && n > limit:
+			return fmt.Sprintf("must be at most %s%s", param, unit), false, nil
+		case name == "len" && n != limit:
+			return fmt.Sprintf("must be exactly %s%s", param, unit), false, nil
+		}
+		return "", true, nil
+	case "oneof":
+		if len(strings.Fields(param)) == 0 {
+			return "", false, fmt.Errorf("rule oneof has no values")
+		}
+		s := fmt.Sprint(v.Interface())
+		if !contains(strings.Fields(param), s) {
+			return "must be one of " + strings.Join(strings.Fields(param), ", "), false, nil
+		}
+		return "", true, nil
+	case "email", "url":
+		if v.Kind() != reflect.String {
+			return "", false, fmt.Errorf("rule %s does not apply to %s", name, v.Kind())
+		}
+		if name == "email" {
+			if addr, err := mail.ParseAddress(v.String()); err != nil || addr.Address != v.String() {
+				return "must be an email address", false, nil
+			}
+		} else if u, err := url.Parse(v.String()); err != nil || u.Scheme == "" || u.Host == "" {
+			return "must be an absolute URL", false, nil
+		}
+		return "", true, nil
+	}
+
+	validationRules.RLock()
+	fn, ok := validationRules.m[name]
+	validationRules.RUnlock()
+	if !ok {
+		return "", false, fmt.Errorf("unknown rule %q", name)
+	}
+	if !fn(v, param) {
+		return "is invalid", false, nil
+	}
+
+	return "", true, nil
+}
+
+// measure returns what min, max and len compare: the length of strings, slices and maps and the value of numbers.
+func measure(v reflect.Value) (float64, string, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), " characters", true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), " items", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), "", true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), "", true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), "", true
+	}
+
+	return 0, "", false
+}
@@ -0,0 +1,212 @@
+package gomux
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hunterdishner/errors"
+)
+
+// WebhookStore persists webhook endpoints and deliveries. Implementations must be safe for concurrent use.
+type WebhookStore interface {
+	PutEndpoint(ctx context.Context, ep WebhookEndpoint) error
+	DeleteEndpoint(ctx context.Context, id string) error
+	Endpoints(ctx context.Context) ([]WebhookEndpoint, error)
+
+	PutDelivery(ctx context.Context, d WebhookDelivery) error
+	// Delivery returns the delivery with the given id, or nil when there is none.
+	Delivery(ctx context.Context, id string) (*WebhookDelivery, error)
+	// Deliveries returns the deliveries in the given status, or all of them for "", oldest first.
+	Deliveries(ctx context.Context, status string) ([]WebhookDelivery, error)
+}
+
+// MemoryWebhookStore is a WebhookStore that keeps everything in memory, losing pending deliveries on restart.
+// Finished deliveries are dropped once they are older than its retention.
+type MemoryWebhookStore struct {
+	retention time.Duration
+
+	mu         sync.Mutex
+	endpoints  map[string]WebhookEndpoint
+	deliveries map[string]WebhookDelivery
+}
+
+// NewMemoryWebhookStore creates a MemoryWebhookStore keeping finished deliveries for retention.
+func NewMemoryWebhookStore(retention time.Duration) *MemoryWebhookStore {
+	return &MemoryWebhookStore{
+		retention:  retention,
+		endpoints:  map[string]WebhookEndpoint{},
+		deliveries: map[string]WebhookDelivery{},
+	}
+}
+
+func (m *MemoryWebhookStore) PutEndpoint(ctx context.Context, ep WebhookEndpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.endpoints[ep.ID] = ep
+	return nil
+}
+
+func (m *MemoryWebhookStore) DeleteEndpoint(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.endpoints, id)
+	return nil
+}
+
+func (m *MemoryWebhookStore) Endpoints(ctx context.Context) ([]WebhookEndpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	endpoints := make([]WebhookEndpoint, 0, len(m.endpoints))
+	for _, ep := range m.endpoints {
+		endpoints = append(endpoints, ep)
+	}
+	sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].ID < endpoints[j].ID })
+
+	return endpoints, nil
+}
+
+func (m *MemoryWebhookStore) PutDelivery(ctx context.Context, d WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.deliveries[d.ID] = d
+	return nil
+}
+
+func (m *MemoryWebhookStore) Delivery(ctx context.Context, id string) (*WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, ok := m.deliveries[id]
+	if !ok || m.expired(d) {
+		return nil, nil
+	}
+
+	return &d, nil
+}
+
+func (m *MemoryWebhookStore) Deliveries(ctx context.Context, status string) ([]WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deliveries []WebhookDelivery
+	for id, d := range m.deliveries {
+		if m.expired(d) {
+			delete(m.deliveries, id)
+			continue
+		}
+		if status == "" || d.Status == status {
+			deliveries = append(deliveries, d)
+		}
+	}
+	sortDeliveries(deliveries)
+
+	return deliveries, nil
+}
+
+func (m *MemoryWebhookStore) expired(d WebhookDelivery) bool {
+	return d.Status != WebhookPending && time.Since(d.Created) > m.retention
+}
+
+// boltWebhookStore keeps webhooks in a bucket of the embedded store. Finished deliveries expire after the
+// retention; endpoints and pending deliveries are kept. Pending deliveries are copied under a prefix of their
+// own, so the dispatcher finds them without scanning those already finished.
+type boltWebhookStore struct {
+	store     *BoltStore
+	retention time.Duration
+}
+
+// boltForever is the TTL of entries that must not expire.
+const boltForever = 100 * 365 * 24 * time.Hour
+
+func (b *boltWebhookStore) PutEndpoint(ctx context.Context, ep WebhookEndpoint) error {
+	return b.put(ctx, "endpoint/"+ep.ID, ep, boltForever)
+}
+
+func (b *boltWebhookStore) DeleteEndpoint(ctx context.Context, id string) error {
+	return b.store.DeletePrefix(ctx, "endpoint/"+id+"\x00")
+}
+
+func (b *boltWebhookStore) Endpoints(ctx context.Context) ([]WebhookEndpoint, error) {
+	var endpoints []WebhookEndpoint
+	err := b.store.scan("endpoint/", func(value []byte) error {
+		var ep WebhookEndpoint
+		if err := json.Unmarshal(value, &ep); err != nil {
+			return err
+		}
+		endpoints = append(endpoints, ep)
+		return nil
+	})
+
+	return endpoints, err
+}
+
+func (b *boltWebhookStore) PutDelivery(ctx context.Context, d WebhookDelivery) error {
+	if d.Status == WebhookPending {
+		if err := b.put(ctx, "pending/"+d.ID, d, boltForever); err != nil {
+			return err
+		}
+		return b.put(ctx, "delivery/"+d.ID, d, boltForever)
+	}
+
+	if err := b.put(ctx, "delivery/"+d.ID, d, b.retention-time.Since(d.Created)); err != nil {
+		return err
+	}
+	return b.store.DeletePrefix(ctx, "pending/"+d.ID+"\x00")
+}
+
+func (b *boltWebhookStore) Delivery(ctx context.Context, id string) (*WebhookDelivery, error) {
+	value, ok, err := b.store.Get(ctx, "delivery/"+id+"\x00")
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	var d WebhookDelivery
+	if err := json.Unmarshal(value, &d); err != nil {
+		return nil, errors.E(errors.Encoding, errors.CodeServerError, err)
+	}
+
+	return &d, nil
+}
+
+func (b *boltWebhookStore) Deliveries(ctx context.Context, status string) ([]WebhookDelivery, error) {
+	prefix := "delivery/"
+	if status == WebhookPending {
+		prefix = "pending/"
+	}
+
+	var deliveries []WebhookDelivery
+	err := b.store.scan(prefix, func(value []byte) error {
+		var d WebhookDelivery
+		if err := json.Unmarshal(value, &d); err != nil {
+			return err
+		}
+		if status == "" || d.Status == status {
+			deliveries = append(deliveries, d)
+		}
+		return nil
+	})
+	sortDeliveries(deliveries)
+
+	return deliveries, err
+}
+
+// put stores v under key, terminated so DeletePrefix only matches the key itself.
+func (b *boltWebhookStore) put(ctx context.Context, key string, v interface{}, ttl time.Duration) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return errors.E(errors.Encoding, errors.CodeServerError, err)
+	}
+
+	return b.store.Set(ctx, key+"\x00", value, ttl)
+}
+
+func sortDeliveries(deliveries []WebhookDelivery) {
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].Created.Before(deliveries[j].Created) })
+}
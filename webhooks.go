@@ -0,0 +1,493 @@
+package gomux
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hunterdishner/errors"
+)
+
+// Webhook delivery statuses.
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed"
+)
+
+// WebhookOptions configures webhook dispatch. Zero values fall back to the defaults noted on each field.
+type WebhookOptions struct {
+	// Store persists endpoints and deliveries. Defaults to the "webhooks" bucket of the EmbeddedStore, or a
+	// MemoryWebhookStore without one.
+	Store WebhookStore
+	// MaxAttempts is how often a delivery is tried before it fails. Defaults to 8.
+	MaxAttempts int
+	// Backoff is the wait before the first retry, doubling with each further one up to MaxBackoff. Defaults to
+	// 30 seconds.
+	Backoff time.Duration
+	// MaxBackoff defaults to an hour.
+	MaxBackoff time.Duration
+	// Timeout bounds each attempt. Defaults to 10 seconds.
+	Timeout time.Duration
+	// Concurrency is how many deliveries are sent at once. Defaults to 4.
+	Concurrency int
+	// Retention is how long finished deliveries can be looked up. Defaults to 7 days.
+	Retention time.Duration
+	// Client sends the deliveries. Defaults to a client without redirects.
+	Client *http.Client
+}
+
+// WebhookEndpoint is a consumer of webhook events.
+type WebhookEndpoint struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// Secret signs the deliveries to the endpoint. A Standard Webhooks secret, "whsec_" followed by base64, is
+	// keyed by its decoded bytes; any other secret by its bytes as is.
+	Secret string `json:"secret"`
+	// Events lists the event types sent to the endpoint. Empty means all of them.
+	Events []string `json:"events,omitempty"`
+}
+
+// WebhookDelivery is an event on its way to an endpoint.
+type WebhookDelivery struct {
+	ID         string `json:"id"`
+	EndpointID string `json:"endpoint_id"`
+	Event      string `json:"event"`
+	// Payload is the body sent to the endpoint.
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	Created     time.Time       `json:"created"`
+	NextAttempt time.Time       `json:"next_attempt,omitempty"`
+	// LastStatus is the HTTP status of the last attempt, 0 when it got no response.
+	LastStatus int    `json:"last_status,omitempty"`
+	LastError  string `json:"last_error,omitempty"`
+}
+
+// Webhooks enables outbound webhooks: endpoints are added with RegisterWebhook and handlers enqueue events with
+// EnqueueEvent. Deliveries are sent while the server serves, retried with exponential backoff on network errors
+// and non-2xx responses (except 410 Gone, which fails the delivery at once) and can be looked up through
+// WebhookDelivery and the admin /webhooks endpoint.
+//
+// Deliveries follow the Standard Webhooks format: a JSON body of {"type", "timestamp", "data"} with
+// webhook-id, webhook-timestamp and webhook-signature headers, the signature being "v1," and the base64
+// HMAC-SHA256, keyed by the endpoint secret, of the id, timestamp and body joined by dots. See VerifyWebhook.
+func Webhooks(opts WebhookOptions) Option {
+	if opts.MaxAttempts == 0 {
+		opts.MaxAttempts = 8
+	}
+	if opts.Backoff == 0 {
+		opts.Backoff = 30 * time.Second
+	}
+	if opts.MaxBackoff == 0 {
+		opts.MaxBackoff = time.Hour
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.Concurrency == 0 {
+		opts.Concurrency = 4
+	}
+	if opts.Retention == 0 {
+		opts.Retention = 7 * 24 * time.Hour
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+	}
+
+	return func(s *Server) {
+		d := &webhookDispatcher{s: s, opts: opts, wake: make(chan struct{}, 1), sending: map[string]bool{}}
+		s.webhooks = d
+		s.Go("webhooks", d.run)
+	}
+}
+
+// RegisterWebhook adds or replaces an endpoint, generating an ID when it has none.
+func (s *Server) RegisterWebhook(ctx context.Context, ep WebhookEndpoint) (WebhookEndpoint, error) {
+	store, err := s.webhookStore()
+	if err != nil {
+		return ep, err
+	}
+
+	if ep.ID == "" {
+		if ep.ID, err = newWebhookID(); err != nil {
+			return ep, err
+		}
+	}
+	if !strings.HasPrefix(ep.URL, "http://") && !strings.HasPrefix(ep.URL, "https://") {
+		return ep, errors.E(errors.Invalid, errors.CodeBadRequest, fmt.Sprintf("webhook url %q is not http(s)", ep.URL))
+	}
+	if _, err := webhookKey(ep.Secret); err != nil {
+		return ep, errors.E(errors.Invalid, errors.CodeBadRequest, fmt.Sprintf("webhook secret is not valid base64 after whsec_: %v", err))
+	}
+
+	return ep, store.PutEndpoint(ctx, ep)
+}
+
+// RemoveWebhook removes an endpoint. Its pending deliveries fail.
+func (s *Server) RemoveWebhook(ctx context.Context, id string) error {
+	store, err := s.webhookStore()
+	if err != nil {
+		return err
+	}
+
+	return store.DeleteEndpoint(ctx, id)
+}
+
+// EnqueueEvent queues a delivery of payload, encoded as JSON, to every endpoint subscribed to event and returns
+// the IDs of the deliveries.
+func (s *Server) EnqueueEvent(ctx context.Context, event string, payload interface{}) ([]string, error) {
+	store, err := s.webhookStore()
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints, err := store.Endpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	body, err := json.Marshal(struct {
+		Type      string      `json:"type"`
+		Timestamp time.Time   `json:"timestamp"`
+		Data      interface{} `json:"data"`
+	}{event, now.UTC(), payload})
+	if err != nil {
+		return nil, errors.E(errors.Encoding, errors.CodeServerError, err)
+	}
+
+	var ids []string
+	for _, ep := range endpoints {
+		if len(ep.Events) > 0 && !contains(ep.Events, event) {
+			continue
+		}
+
+		id, err := newWebhookID()
+		if err != nil {
+			return ids, err
+		}
+		d := WebhookDelivery{ID: id, EndpointID: ep.ID, Event: event, Payload: body, Status: WebhookPending, Created: now, NextAttempt: now}
+		if err := store.PutDelivery(ctx, d); err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+
+	if len(ids) > 0 {
+		s.webhooks.notify()
+	}
+
+	return ids, nil
+}
+
+// WebhookDelivery looks up a delivery, returning nil when there is none.
+func (s *Server) WebhookDelivery(ctx context.Context, id string) (*WebhookDelivery, error) {
+	store, err := s.webhookStore()
+	if err != nil {
+		return nil, err
+	}
+
+	return store.Delivery(ctx, id)
+}
+
+// webhookReport serves the deliveries, optionally filtered by ?status=, on the admin /webhooks endpoint.
+func (s *Server) webhookReport(w io.Writer, r *http.Request) (interface{}, error) {
+	store, err := s.webhookStore()
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries, err := store.Deliveries(r.Context(), r.URL.Query().Get("status"))
+	if deliveries == nil {
+		deliveries = []WebhookDelivery{}
+	}
+
+	return deliveries, err
+}
+
+func (s *Server) webhookStore() (WebhookStore, error) {
+	if s.webhooks == nil {
+		return nil, errors.E(errors.Invalid, errors.CodeServerError, "webhooks are not enabled, see Webhooks")
+	}
+
+	return s.webhooks.store()
+}
+
+// VerifyWebhook checks the signature of a webhook request against secret, rejecting timestamps further than
+// tolerance from now, and returns the body. It is the receiving side of Webhooks.
+func VerifyWebhook(r *http.Request, secret string, tolerance time.Duration) ([]byte, error) {
+	id, ts := r.Header.Get("webhook-id"), r.Header.Get("webhook-timestamp")
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if id == "" || err != nil {
+		return nil, errors.E(errors.Invalid, errors.CodeBadRequest, "missing webhook-id or webhook-timestamp")
+	}
+	if d := time.Since(time.Unix(unix, 0)); d > tolerance || d < -tolerance {
+		return nil, errors.E(errors.Invalid, errors.Code(http.StatusUnauthorized), "webhook timestamp out of tolerance")
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, errors.E(errors.IO, errors.CodeBadRequest, err)
+	}
+
+	want := signWebhook(secret, id, ts, body)
+	for _, sig := range strings.Fields(r.Header.Get("webhook-signature")) {
+		if hmac.Equal([]byte(sig), []byte(want)) {
+			return body, nil
+		}
+	}
+
+	return nil, errors.E(errors.Invalid, errors.Code(http.StatusUnauthorized), "invalid webhook signature")
+}
+
+func signWebhook(secret, id, timestamp string, body []byte) string {
+	key, err := webhookKey(secret)
+	if err != nil {
+		key = []byte(secret)
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id + "." + timestamp + "."))
+	mac.Write(body)
+
+	return "v1," + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// webhookKey returns the HMAC key of secret, decoding Standard Webhooks "whsec_" secrets.
+func webhookKey(secret string) ([]byte, error) {
+	if encoded, ok := strings.CutPrefix(secret, "whsec_"); ok {
+		return base64.StdEncoding.DecodeString(encoded)
+	}
+
+	return []byte(secret), nil
+}
+
+func newWebhookID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.E(errors.IO, errors.CodeServerError, err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+type webhookDispatcher struct {
+	s    *Server
+	opts WebhookOptions
+	wake chan struct{}
+
+	once     sync.Once
+	resolved WebhookStore
+	err      error
+
+	mu      sync.Mutex
+	sending map[string]bool
+}
+
+// store resolves the configured store on first use, once every option has been applied.
+func (d *webhookDispatcher) store() (WebhookStore, error) {
+	d.once.Do(func() {
+		switch {
+		case d.opts.Store != nil:
+			d.resolved = d.opts.Store
+		case d.s.store != nil:
+			store, err := d.s.Store("webhooks")
+			if err != nil {
+				d.err = err
+				return
+			}
+			d.resolved = &boltWebhookStore{store: store, retention: d.opts.Retention}
+		default:
+			d.resolved = NewMemoryWebhookStore(d.opts.Retention)
+		}
+	})
+
+	return d.resolved, d.err
+}
+
+func (d *webhookDispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run sends due deliveries until ctx is done, looking for them every second and whenever events are enqueued.
+func (d *webhookDispatcher) run(ctx context.Context) error {
+	store, err := d.store()
+	if err != nil {
+		return err
+	}
+
+	slots := make(chan struct{}, d.opts.Concurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		pending, err := store.Deliveries(ctx, WebhookPending)
+		if err != nil {
+			log.Printf("%+v", err)
+		}
+
+		for _, delivery := range pending {
+			if delivery.NextAttempt.After(time.Now()) || !d.claim(delivery.ID) {
+				continue
+			}
+
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				d.release(delivery.ID)
+				return nil
+			}
+			wg.Add(1)
+			go func(id string) {
+				defer func() {
+					d.release(id)
+					<-slots
+					wg.Done()
+				}()
+				d.attempt(ctx, store, id)
+			}(delivery.ID)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+func (d *webhookDispatcher) claim(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.sending[id] {
+		return false
+	}
+	d.sending[id] = true
+	return true
+}
+
+func (d *webhookDispatcher) release(id string) {
+	d.mu.Lock()
+	delete(d.sending, id)
+	d.mu.Unlock()
+}
+
+// attempt sends a delivery once and records the outcome.
+func (d *webhookDispatcher) attempt(ctx context.Context, store WebhookStore, id string) {
+	// The list the delivery was picked from may predate an attempt that just finished.
+	current, err := store.Delivery(ctx, id)
+	if err != nil {
+		log.Printf("%+v", err)
+		return
+	}
+	if current == nil || current.Status != WebhookPending || current.NextAttempt.After(time.Now()) {
+		return
+	}
+	delivery := *current
+
+	endpoints, err := store.Endpoints(ctx)
+	if err != nil {
+		log.Printf("%+v", err)
+		return
+	}
+
+	var ep *WebhookEndpoint
+	for i := range endpoints {
+		if endpoints[i].ID == delivery.EndpointID {
+			ep = &endpoints[i]
+		}
+	}
+
+	delivery.Attempts++
+	delivery.LastStatus, delivery.LastError = 0, ""
+	retry := true
+	switch {
+	case ep == nil:
+		delivery.LastError, retry = "endpoint was removed", false
+	default:
+		status, err := d.send(ctx, *ep, delivery)
+		if ctx.Err() != nil {
+			// Shutting down: the attempt does not count.
+			return
+		}
+		delivery.LastStatus = status
+		switch {
+		case err != nil:
+			delivery.LastError = err.Error()
+		case status >= 200 && status < 300:
+			delivery.Status, retry = WebhookDelivered, false
+		case status == http.StatusGone:
+			delivery.LastError, retry = "endpoint is gone", false
+		default:
+			delivery.LastError = fmt.Sprintf("endpoint answered %d", status)
+		}
+	}
+
+	if delivery.Status == WebhookPending {
+		if !retry || delivery.Attempts >= d.opts.MaxAttempts {
+			delivery.Status = WebhookFailed
+			log.Printf("%+v", errors.E(errors.IO, errors.CodeServerError, fmt.Sprintf("webhook delivery %s of %s to %s failed after %d attempts: %s", delivery.ID, delivery.Event, delivery.EndpointID, delivery.Attempts, delivery.LastError)))
+		} else {
+			backoff := d.opts.Backoff << (delivery.Attempts - 1)
+			if backoff > d.opts.MaxBackoff || backoff <= 0 {
+				backoff = d.opts.MaxBackoff
+			}
+			delivery.NextAttempt = time.Now().Add(backoff)
+		}
+	}
+	if delivery.Status != WebhookPending {
+		delivery.NextAttempt = time.Time{}
+	}
+
+	if err := store.PutDelivery(context.WithoutCancel(ctx), delivery); err != nil {
+		log.Printf("%+v", err)
+	}
+}
+
+func (d *webhookDispatcher) send(ctx context.Context, ep WebhookEndpoint, delivery WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.opts.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("webhook-id", delivery.ID)
+	req.Header.Set("webhook-timestamp", ts)
+	req.Header.Set("webhook-signature", signWebhook(ep.Secret, delivery.ID, ts, delivery.Payload))
+
+	resp, err := d.opts.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,163 @@
+package gomux
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/hunterdishner/errors"
+)
+
+// Go registers a background worker, e.g. a queue consumer, that runs while the server serves. Workers start
+// with Serve or Start, or straight away when they are already running, and share a context that is cancelled when the
+// server's context is or Serve fails; Serve then waits for them as long as DrainTimeout allows.
+//
+// A worker that fails, returning an error or panicking, is logged and restarted after a backoff growing from a
+// second to a minute. Returning nil ends the worker. Failures are counted in the admin /workers report.
+func (s *Server) Go(name string, fn func(ctx context.Context) error) {
+	w := &worker{fn: fn, stat: WorkerStat{Name: name}}
+
+	g := s.workers
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.list = append(g.list, w)
+	if g.ctx != nil {
+		g.run(w)
+	}
+}
+
+// WorkerStat reports on a background worker.
+type WorkerStat struct {
+	Name        string     `json:"name"`
+	Running     bool       `json:"running"`
+	Runs        int        `json:"runs"`
+	Failures    int        `json:"failures"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastFailure *time.Time `json:"last_failure,omitempty"`
+}
+
+// Workers reports on the workers registered with Go, in the order they were registered.
+func (s *Server) Workers() []WorkerStat {
+	g := s.workers
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	stats := make([]WorkerStat, 0, len(g.list))
+	for _, w := range g.list {
+		stats = append(stats, w.snapshot())
+	}
+
+	return stats
+}
+
+func (s *Server) workerStats(w io.Writer, r *http.Request) (interface{}, error) {
+	return s.Workers(), nil
+}
+
+type workerGroup struct {
+	mu     sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	list   []*worker
+}
+
+type worker struct {
+	fn func(ctx context.Context) error
+
+	mu   sync.Mutex
+	stat WorkerStat
+}
+
+func (w *worker) snapshot() WorkerStat {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.stat
+}
+
+// start runs the registered workers under ctx. The returned func cancels them and waits for them to
+// return, for at most timeout.
+func (g *workerGroup) start(ctx context.Context, timeout time.Duration) func() {
+	g.mu.Lock()
+	g.ctx, g.cancel = context.WithCancel(ctx)
+	for _, w := range g.list {
+		g.run(w)
+	}
+	g.mu.Unlock()
+
+	return func() {
+		g.cancel()
+
+		done := make(chan struct{})
+		go func() {
+			g.wg.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(timeout):
+			log.Printf("%+v", errors.E(errors.IO, errors.CodeServerError, fmt.Sprintf("workers still running %s after shutdown", timeout)))
+		}
+	}
+}
+
+// run starts w. g.mu must be held.
+func (g *workerGroup) run(w *worker) {
+	ctx := g.ctx
+	g.wg.Add(1)
+
+	go func() {
+		defer g.wg.Done()
+
+		backoff := time.Second
+		for {
+			err := w.once(ctx)
+			if err == nil || ctx.Err() != nil {
+				return
+			}
+
+			log.Printf("%+v", errors.E(errors.IO, errors.CodeServerError, fmt.Sprintf("worker %s failed, restarting in %s: %v", w.stat.Name, backoff, err)))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > time.Minute {
+				backoff = time.Minute
+			}
+		}
+	}()
+}
+
+// once runs the worker a single time, turning a panic into its error.
+func (w *worker) once(ctx context.Context) (err error) {
+	w.mu.Lock()
+	w.stat.Running = true
+	w.stat.Runs++
+	w.mu.Unlock()
+
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("panic: %v\n%s", v, debug.Stack())
+		}
+
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.stat.Running = false
+		if err != nil && ctx.Err() == nil {
+			w.stat.Failures++
+			now := time.Now()
+			w.stat.LastError, w.stat.LastFailure = err.Error(), &now
+		}
+	}()
+
+	return w.fn(ctx)
+}